@@ -0,0 +1,325 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/open-lambda/open-lambda/go/common"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const applyUsage = "ol admin apply -f <stack.yaml> [--prune] [--dry-run] [boss | -p <worker_path>]"
+
+// stackFile describes a set of lambdas that should be deployed together.
+// Example:
+//
+//	lambdas:
+//	  - source: ./hello
+//	  - name: ingest
+//	    source: https://github.com/me/ingest.git
+//	    config: ./ingest-prod.yaml
+//	    requirements: ./ingest-requirements.txt
+type stackFile struct {
+	Lambdas []stackLambda `yaml:"lambdas"`
+}
+
+type stackLambda struct {
+	Name         string `yaml:"name"`         // defaults to the directory or repo name
+	Source       string `yaml:"source"`       // local directory or git URL
+	Config       string `yaml:"config"`       // optional ol.yaml override
+	Requirements string `yaml:"requirements"` // optional requirements.txt override
+}
+
+// builtLambda is a stack entry that has been packed and is ready to diff.
+type builtLambda struct {
+	name     string
+	tarData  []byte
+	digest   string
+	hasKafka bool
+}
+
+type applyAction string
+
+const (
+	applyCreate    applyAction = "create"
+	applyUpdate    applyAction = "update"
+	applyUnchanged applyAction = "unchanged"
+	applyDelete    applyAction = "delete"
+)
+
+type applyStep struct {
+	action applyAction
+	name   string
+	lambda *builtLambda // nil for deletes
+}
+
+// loadStackFile parses a stack file.  Relative local paths are resolved
+// against the directory containing the stack file.
+func loadStackFile(path string) (*stackFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stack file %s: %v", path, err)
+	}
+
+	var stack stackFile
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return nil, fmt.Errorf("failed to parse stack file %s: %v", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || isGitURL(p) || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+
+	for i := range stack.Lambdas {
+		l := &stack.Lambdas[i]
+		if l.Source == "" {
+			return nil, fmt.Errorf("lambda #%d in %s has no source", i, path)
+		}
+		l.Source = resolve(l.Source)
+		l.Config = resolve(l.Config)
+		l.Requirements = resolve(l.Requirements)
+	}
+
+	return &stack, nil
+}
+
+// buildStackLambda fetches the source of one stack entry and packs it the
+// same way `ol admin install` would.
+func buildStackLambda(l stackLambda) (*builtLambda, error) {
+	funcDir, funcName, tmpDir, err := fetchSource(l.Source)
+	if err != nil {
+		return nil, err
+	}
+	if tmpDir != "" {
+		defer os.RemoveAll(tmpDir)
+	}
+
+	if l.Name != "" {
+		funcName = l.Name
+	}
+	if err := common.ValidateFunctionName(funcName); err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]string)
+	for targetFile, path := range map[string]string{"ol.yaml": l.Config, "requirements.txt": l.Requirements} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: override file %s does not exist", funcName, path)
+		}
+		overrides[targetFile] = path
+	}
+
+	tarData, err := createTarGz(funcDir, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to create tar.gz: %v", funcName, err)
+	}
+
+	// the override, if any, is what gets packed as ol.yaml
+	configPath := filepath.Join(funcDir, common.LambdaConfigFilename)
+	if l.Config != "" {
+		configPath = l.Config
+	}
+	cfg, err := common.LoadLambdaConfigFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse config: %v", funcName, err)
+	}
+
+	sum := sha256.Sum256(tarData)
+	return &builtLambda{
+		name:     funcName,
+		tarData:  tarData,
+		digest:   hex.EncodeToString(sum[:]),
+		hasKafka: len(cfg.Triggers.Kafka) > 0,
+	}, nil
+}
+
+// planApply compares the desired lambdas against the registry digests and
+// returns the steps needed to converge, sorted by name.
+func planApply(desired []*builtLambda, current map[string]string, prune bool) []applyStep {
+	steps := []applyStep{}
+	wanted := make(map[string]bool)
+
+	for _, l := range desired {
+		wanted[l.name] = true
+		digest, ok := current[l.name]
+		switch {
+		case !ok:
+			steps = append(steps, applyStep{applyCreate, l.name, l})
+		case digest != l.digest:
+			steps = append(steps, applyStep{applyUpdate, l.name, l})
+		default:
+			steps = append(steps, applyStep{applyUnchanged, l.name, l})
+		}
+	}
+
+	if prune {
+		for name := range current {
+			if !wanted[name] {
+				steps = append(steps, applyStep{applyDelete, name, nil})
+			}
+		}
+	}
+
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].name < steps[j].name
+	})
+	return steps
+}
+
+func fetchRegistryDigests(port string) (map[string]string, error) {
+	url := fmt.Sprintf("http://localhost:%s/registry/?digests=true", port)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registry: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("listing registry failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	digests := make(map[string]string)
+	if err := json.NewDecoder(resp.Body).Decode(&digests); err != nil {
+		return nil, fmt.Errorf("failed to decode registry listing: %v", err)
+	}
+	return digests, nil
+}
+
+// sendAdminRequest issues a body-less request against the boss/worker and
+// returns an error for any non-2xx status.
+func sendAdminRequest(method string, port string, path string) error {
+	url := fmt.Sprintf("http://localhost:%s%s", port, path)
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed with status %d: %s", method, path, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func adminApply(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	workerPath := ctx.String("path")
+	stackPath := ctx.String("file")
+
+	if stackPath == "" {
+		return fmt.Errorf("usage: %s", applyUsage)
+	}
+
+	target := "worker"
+	if len(args) == 1 && args[0] == "boss" {
+		target = "boss"
+		if workerPath != "" {
+			return fmt.Errorf("cannot use both 'boss' and '-p' flags together")
+		}
+	} else if len(args) != 0 {
+		return fmt.Errorf("usage: %s", applyUsage)
+	}
+
+	stack, err := loadStackFile(stackPath)
+	if err != nil {
+		return err
+	}
+
+	port, err := targetPort(ctx, target, workerPath)
+	if err != nil {
+		return err
+	}
+
+	desired := make([]*builtLambda, 0, len(stack.Lambdas))
+	seen := make(map[string]bool)
+	for _, l := range stack.Lambdas {
+		built, err := buildStackLambda(l)
+		if err != nil {
+			return err
+		}
+		if seen[built.name] {
+			return fmt.Errorf("lambda %s appears more than once in %s", built.name, stackPath)
+		}
+		seen[built.name] = true
+		desired = append(desired, built)
+	}
+
+	current, err := fetchRegistryDigests(port)
+	if err != nil {
+		return err
+	}
+
+	steps := planApply(desired, current, ctx.Bool("prune"))
+
+	fmt.Printf("Plan (%s on port %s):\n", target, port)
+	changes := 0
+	for _, step := range steps {
+		fmt.Printf("  %-9s %s\n", step.action, step.name)
+		if step.action != applyUnchanged {
+			changes++
+		}
+	}
+	if changes == 0 {
+		fmt.Printf("Nothing to do.\n")
+		return nil
+	}
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+
+	for _, step := range steps {
+		switch step.action {
+		case applyCreate, applyUpdate:
+			if err := uploadToLambdaStore(step.name, step.lambda.tarData, port); err != nil {
+				return fmt.Errorf("failed to %s %s: %v", step.action, step.name, err)
+			}
+			// the boss registers triggers on upload, but a worker needs
+			// to be told to start its Kafka consumers
+			if target == "worker" && step.lambda.hasKafka {
+				if err := sendAdminRequest("POST", port, "/kafka/register/"+step.name); err != nil {
+					return fmt.Errorf("failed to register Kafka triggers for %s: %v", step.name, err)
+				}
+			}
+		case applyDelete:
+			if target == "worker" {
+				if err := sendAdminRequest("DELETE", port, "/kafka/register/"+step.name); err != nil {
+					fmt.Printf("Warning: failed to unregister Kafka triggers for %s: %v\n", step.name, err)
+				}
+			}
+			if err := sendAdminRequest("DELETE", port, "/registry/"+step.name); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", step.name, err)
+			}
+		default:
+			continue
+		}
+		fmt.Printf("%s: %s done\n", step.name, step.action)
+	}
+
+	fmt.Printf("Applied %d change(s) from %s\n", changes, stackPath)
+	return nil
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPlanApply verifies that each lambda in the stack is diffed against
+// the registry by digest, and that deletes only happen with prune.
+func TestPlanApply(t *testing.T) {
+	desired := []*builtLambda{
+		{name: "new", digest: "a"},
+		{name: "changed", digest: "b"},
+		{name: "same", digest: "c"},
+	}
+	current := map[string]string{
+		"changed": "old",
+		"same":    "c",
+		"gone":    "d",
+	}
+
+	for _, tc := range []struct {
+		prune bool
+		want  []applyStep
+	}{
+		{false, []applyStep{
+			{applyUpdate, "changed", desired[1]},
+			{applyCreate, "new", desired[0]},
+			{applyUnchanged, "same", desired[2]},
+		}},
+		{true, []applyStep{
+			{applyUpdate, "changed", desired[1]},
+			{applyDelete, "gone", nil},
+			{applyCreate, "new", desired[0]},
+			{applyUnchanged, "same", desired[2]},
+		}},
+	} {
+		steps := planApply(desired, current, tc.prune)
+		if len(steps) != len(tc.want) {
+			t.Fatalf("prune=%v: expected %d steps, got %v", tc.prune, len(tc.want), steps)
+		}
+		for i, want := range tc.want {
+			if steps[i] != want {
+				t.Errorf("prune=%v: step %d: expected %v, got %v", tc.prune, i, want, steps[i])
+			}
+		}
+	}
+}
+
+// TestBuildStackLambdaConfigOverride verifies that triggers come from the
+// override config, which is what gets deployed as ol.yaml.
+func TestBuildStackLambdaConfigOverride(t *testing.T) {
+	dir := t.TempDir()
+	funcDir := filepath.Join(dir, "ingest")
+	if err := os.Mkdir(funcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(funcDir, "f.py"), []byte("def f(event):\n    return event\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	override := filepath.Join(dir, "prod-ol.yaml")
+	kafka := "triggers:\n  kafka:\n    - bootstrap_servers: [\"localhost:9092\"]\n      topics: [\"orders\"]\n"
+	if err := os.WriteFile(override, []byte(kafka), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	built, err := buildStackLambda(stackLambda{Source: funcDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.hasKafka {
+		t.Errorf("expected no Kafka triggers without the override")
+	}
+
+	built, err = buildStackLambda(stackLambda{Source: funcDir, Config: override})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !built.hasKafka {
+		t.Errorf("expected Kafka triggers from %s", override)
+	}
+}
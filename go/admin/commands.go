@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -69,81 +70,98 @@ func cloneGitRepo(gitURL string) (string, error) {
 	return tmpDir, nil
 }
 
-func adminInstall(ctx *cli.Context) error {
-	args := ctx.Args().Slice()
-	var installTarget string
-	var funcDir string
-
-	workerPath := ctx.String("path")
-
-	if len(args) == 0 {
-		return fmt.Errorf("usage: %s", installUsage)
-	}
-	if len(args) == 1 {
-		funcDir = args[0]
-		installTarget = "worker"
-
-	} else if len(args) == 2 && args[0] == "boss" {
-		installTarget = "boss"
-		funcDir = args[1]
-		if workerPath != "" {
-			return fmt.Errorf("cannot use both 'boss' and '-p' flags together")
-		}
-	} else {
-		return fmt.Errorf("usage: %s", installUsage)
-	}
-
-	var portToUploadLambda string
-
-	switch installTarget {
+// targetPort loads the boss or worker config for target ("boss" or
+// "worker"), checks that it is running, and returns the port it serves
+// the registry on.
+func targetPort(ctx *cli.Context, target string, workerPath string) (string, error) {
+	switch target {
 	case "boss":
 		if err := config.LoadConf("boss.json"); err != nil {
-			return fmt.Errorf("failed to load boss config: %v", err)
+			return "", fmt.Errorf("failed to load boss config: %v", err)
 		}
 		if err := checkStatus(config.BossConf.Boss_port); err != nil {
-			return fmt.Errorf("boss is not running: %v", err)
+			return "", fmt.Errorf("boss is not running: %v", err)
 		}
-		portToUploadLambda = config.BossConf.Boss_port
+		return config.BossConf.Boss_port, nil
 
 	case "worker":
 		if workerPath == "" {
 			olPath, err := common.GetOlPath(ctx)
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			if err := common.LoadDefaults(olPath); err != nil {
-				return fmt.Errorf("failed to load default worker config for %s: %v", workerPath, err)
+				return "", fmt.Errorf("failed to load default worker config for %s: %v", workerPath, err)
 			}
 		} else {
 			if err := common.LoadGlobalConfig(filepath.Join(workerPath, "config.json")); err != nil {
-				return fmt.Errorf("failed to load worker config for %s: %v", workerPath, err)
+				return "", fmt.Errorf("failed to load worker config for %s: %v", workerPath, err)
 			}
 		}
 
 		if err := checkStatus(common.Conf.Worker_port); err != nil {
-			return fmt.Errorf("worker %s is not running: %v", workerPath, err)
+			return "", fmt.Errorf("worker %s is not running: %v", workerPath, err)
 		}
-		portToUploadLambda = common.Conf.Worker_port
+		return common.Conf.Worker_port, nil
 	}
 
-	var funcName string
-	var tmpDir string
+	return "", fmt.Errorf("unknown target %q", target)
+}
 
-	if isGitURL(funcDir) {
-		funcName = strings.TrimSuffix(filepath.Base(funcDir), ".git")
-		clonedDir, err := cloneGitRepo(funcDir)
+// fetchSource resolves a local directory or git URL to a directory on
+// disk and a default function name.  If tmpDir is non-empty, the caller
+// must remove it when done.
+func fetchSource(src string) (funcDir string, funcName string, tmpDir string, err error) {
+	if isGitURL(src) {
+		funcName = strings.TrimSuffix(filepath.Base(src), ".git")
+		clonedDir, err := cloneGitRepo(src)
 		if err != nil {
-			return err
+			return "", "", "", err
 		}
-		tmpDir = clonedDir
-		funcDir = clonedDir
-	} else {
-		funcDir = strings.TrimSuffix(funcDir, "/")
-		funcName = filepath.Base(funcDir)
-		if _, err := os.Stat(funcDir); os.IsNotExist(err) {
-			return fmt.Errorf("directory %s does not exist", funcDir)
+		return clonedDir, funcName, clonedDir, nil
+	}
+
+	funcDir = strings.TrimSuffix(src, "/")
+	funcName = filepath.Base(funcDir)
+	if _, err := os.Stat(funcDir); os.IsNotExist(err) {
+		return "", "", "", fmt.Errorf("directory %s does not exist", funcDir)
+	}
+	return funcDir, funcName, "", nil
+}
+
+func adminInstall(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	var installTarget string
+	var funcDir string
+
+	workerPath := ctx.String("path")
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", installUsage)
+	}
+	if len(args) == 1 {
+		funcDir = args[0]
+		installTarget = "worker"
+
+	} else if len(args) == 2 && args[0] == "boss" {
+		installTarget = "boss"
+		funcDir = args[1]
+		if workerPath != "" {
+			return fmt.Errorf("cannot use both 'boss' and '-p' flags together")
 		}
+	} else {
+		return fmt.Errorf("usage: %s", installUsage)
+	}
+
+	portToUploadLambda, err := targetPort(ctx, installTarget, workerPath)
+	if err != nil {
+		return err
+	}
+
+	funcDir, funcName, tmpDir, err := fetchSource(funcDir)
+	if err != nil {
+		return err
 	}
 
 	// Override function name if specified
@@ -246,6 +264,7 @@ func createTarGz(funcDir string, overrides map[string]string) ([]byte, error) {
 			return fmt.Errorf("unable to create header: %v", err)
 		}
 		header.Name = relPath
+		normalizeHeader(header)
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return fmt.Errorf("failed to write header: %v", err)
@@ -271,8 +290,15 @@ func createTarGz(funcDir string, overrides map[string]string) ([]byte, error) {
 		return nil, err
 	}
 
-	// Add override files
-	for relPath, localPath := range overrides {
+	// Add override files (in sorted order, so the archive is reproducible)
+	overridePaths := make([]string, 0, len(overrides))
+	for relPath := range overrides {
+		overridePaths = append(overridePaths, relPath)
+	}
+	sort.Strings(overridePaths)
+
+	for _, relPath := range overridePaths {
+		localPath := overrides[relPath]
 		info, err := os.Stat(localPath)
 		if err != nil {
 			return nil, fmt.Errorf("unable to stat override file %s: %v", localPath, err)
@@ -283,6 +309,7 @@ func createTarGz(funcDir string, overrides map[string]string) ([]byte, error) {
 			return nil, fmt.Errorf("unable to create header for override %s: %v", relPath, err)
 		}
 		header.Name = relPath
+		normalizeHeader(header)
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return nil, fmt.Errorf("failed to write header for override %s: %v", relPath, err)
@@ -313,6 +340,19 @@ func createTarGz(funcDir string, overrides map[string]string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// normalizeHeader strips metadata that varies between checkouts of the same
+// code (timestamps, owners), so identical sources produce identical
+// tarballs and digests.
+func normalizeHeader(header *tar.Header) {
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+}
+
 func uploadToLambdaStore(funcName string, tarData []byte, port string) error {
 	host := "localhost"
 
@@ -373,5 +413,103 @@ func AdminCommands() []*cli.Command {
 				},
 			},
 		},
+		{
+			Name:      "apply",
+			Usage:     "Deploy the lambdas listed in a stack file, uploading only those that changed",
+			UsageText: applyUsage,
+			Action:    adminApply,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "file",
+					Aliases: []string{"f"},
+					Usage:   "Path to stack.yaml listing the lambdas to deploy",
+				},
+				&cli.StringFlag{
+					Name:    "path",
+					Aliases: []string{"p"},
+					Usage:   "Worker directory path (e.g., -p myworker)",
+				},
+				&cli.BoolFlag{
+					Name:  "prune",
+					Usage: "Delete lambdas in the registry that are not listed in the stack file",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Print the plan without applying it",
+				},
+			},
+		},
+		{
+			Name:      "dev",
+			Usage:     "Watch a lambda directory, redeploying it to a worker on every change and streaming its output",
+			UsageText: devUsage,
+			Action:    adminDev,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "path",
+					Aliases: []string{"p"},
+					Usage:   "Worker directory path (e.g., -p myworker)",
+				},
+				&cli.StringFlag{
+					Name:    "name",
+					Aliases: []string{"n"},
+					Usage:   "Lambda function name (defaults to directory name)",
+				},
+			},
+		},
+		{
+			Name:      "recommend",
+			Usage:     "Suggest memory and CPU limits for a lambda from its recent usage on a worker",
+			UsageText: recommendUsage,
+			Action:    adminRecommend,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "path",
+					Aliases: []string{"p"},
+					Usage:   "Worker directory path (e.g., -p myworker)",
+				},
+			},
+		},
+		{
+			Name:      "test",
+			Usage:     "Deploy a lambda under a temporary name, replay event fixtures against it, and report results as JUnit XML",
+			UsageText: testUsage,
+			Action:    adminTest,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "event",
+					Usage: "JSON file with one fixture or a list of fixtures (may be repeated)",
+				},
+				&cli.StringFlag{
+					Name:  "expect",
+					Usage: "JSON file mapping fixture names to expected status/body/headers (default: expect status 200)",
+				},
+				&cli.StringFlag{
+					Name:  "junit",
+					Usage: "Write the JUnit XML report to this file instead of stdout",
+				},
+				&cli.StringFlag{
+					Name:    "path",
+					Aliases: []string{"p"},
+					Usage:   "Use this running worker instead of starting an ephemeral one",
+				},
+				&cli.StringFlag{
+					Name:  "ephemeral-path",
+					Value: "ol-test-worker",
+					Usage: "Worker directory for the ephemeral worker (kept between runs to reuse the base image)",
+				},
+				&cli.StringFlag{
+					Name:    "image",
+					Aliases: []string{"i"},
+					Value:   "ol-min",
+					Usage:   "Base image for the ephemeral worker",
+				},
+				&cli.DurationFlag{
+					Name:  "timeout",
+					Value: 60 * time.Second,
+					Usage: "Timeout for each fixture request",
+				},
+			},
+		},
 	}
 }
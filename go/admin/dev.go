@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
+
+	"github.com/urfave/cli/v2"
+)
+
+const devUsage = "ol admin dev [-n <name>] [-p <worker_path>] <directory>"
+
+// wait this long after a change before re-packing, so that a burst of
+// writes (e.g., an editor saving several files) causes one upload
+const devDebounce = 300 * time.Millisecond
+
+// how often to look for new runtime output
+const devLogPollInterval = 500 * time.Millisecond
+
+const devWatchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+
+// dirWatcher uses inotify to report changes anywhere under a directory
+type dirWatcher struct {
+	fd   int
+	root string
+}
+
+func newDirWatcher(root string) (*dirWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init failed: %v", err)
+	}
+
+	w := &dirWatcher{fd: fd, root: root}
+	if err := w.watchTree(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return w, nil
+}
+
+// watchTree adds a watch for every directory under root.  Re-adding an
+// existing watch is harmless, so this is also used to pick up new subdirs.
+func (w *dirWatcher) watchTree() error {
+	return filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// the dir may have been removed while we walk
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if _, err := unix.InotifyAddWatch(w.fd, path, devWatchMask); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// run blocks reading inotify events, signaling changes without ever
+// blocking on the receiver (pending signals are coalesced).
+func (w *dirWatcher) run(changes chan<- struct{}) {
+	buf := make([]byte, 64*1024)
+	for {
+		if _, err := unix.Read(w.fd, buf); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			fmt.Printf("Warning: stopped watching %s: %v\n", w.root, err)
+			return
+		}
+
+		if err := w.watchTree(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// tailRuntimeLogs copies runtime output of all sandboxes belonging to
+// funcName to out.  Each lambda instance gets a scratch dir named
+// <id>-<funcName>, with the runtime's stdout/stderr in it.
+func tailRuntimeLogs(scratchRoot string, funcName string, out io.Writer) {
+	offsets := make(map[string]int64)
+
+	for {
+		entries, _ := os.ReadDir(scratchRoot)
+		seen := make(map[string]bool)
+
+		for _, entry := range entries {
+			id, name, ok := strings.Cut(entry.Name(), "-")
+			if !ok || name != funcName || !entry.IsDir() {
+				continue
+			}
+
+			path := filepath.Join(scratchRoot, entry.Name(), sandbox.RUNTIME_LOG_NAME)
+			seen[path] = true
+
+			file, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			// the worker truncates logs that pass runtime_log_kb
+			if info, err := file.Stat(); err == nil && info.Size() < offsets[path] {
+				offsets[path] = 0
+			}
+			if _, err := file.Seek(offsets[path], io.SeekStart); err == nil {
+				data, _ := io.ReadAll(file)
+				offsets[path] += int64(len(data))
+				for _, line := range strings.SplitAfter(string(data), "\n") {
+					if line != "" {
+						fmt.Fprintf(out, "[%s %s] %s", funcName, id, line)
+					}
+				}
+			}
+			file.Close()
+		}
+
+		// forget sandboxes that have been destroyed
+		for path := range offsets {
+			if !seen[path] {
+				delete(offsets, path)
+			}
+		}
+
+		time.Sleep(devLogPollInterval)
+	}
+}
+
+func adminDev(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", devUsage)
+	}
+
+	funcDir := strings.TrimSuffix(args[0], "/")
+	info, err := os.Stat(funcDir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", funcDir)
+	}
+
+	funcName := filepath.Base(funcDir)
+	if name := ctx.String("name"); name != "" {
+		funcName = name
+	}
+	if err := common.ValidateFunctionName(funcName); err != nil {
+		return err
+	}
+
+	port, err := targetPort(ctx, "worker", ctx.String("path"))
+	if err != nil {
+		return err
+	}
+
+	lastDigest := ""
+	deploy := func() {
+		tarData, err := createTarGz(funcDir, nil)
+		if err != nil {
+			fmt.Printf("[dev] not deploying %s: %v\n", funcName, err)
+			return
+		}
+
+		sum := sha256.Sum256(tarData)
+		digest := hex.EncodeToString(sum[:])
+		if digest == lastDigest {
+			return
+		}
+
+		// the worker invalidates its cached copy and restarts
+		// instances as part of handling the upload
+		if err := uploadToLambdaStore(funcName, tarData, port); err != nil {
+			fmt.Printf("[dev] upload of %s failed: %v\n", funcName, err)
+			return
+		}
+
+		lastDigest = digest
+		fmt.Printf("[dev] deployed %s (%s)\n", funcName, digest[:12])
+	}
+
+	watcher, err := newDirWatcher(funcDir)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(watcher.fd)
+
+	changes := make(chan struct{}, 1)
+	go watcher.run(changes)
+	if common.Conf.Runtime_log_kb > 0 {
+		go tailRuntimeLogs(filepath.Join(common.Conf.Worker_dir, "scratch"), funcName, os.Stdout)
+	} else {
+		fmt.Printf("[dev] runtime output is in the worker's log (set runtime_log_kb in the worker's config.json to stream it here)\n")
+	}
+
+	deploy()
+	fmt.Printf("[dev] watching %s; invoke with: curl localhost:%s/run/%s/ (Ctrl-C to stop)\n",
+		funcDir, port, funcName)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-changes:
+			time.Sleep(devDebounce)
+			select {
+			case <-changes:
+			default:
+			}
+			deploy()
+		case <-stop:
+			return nil
+		}
+	}
+}
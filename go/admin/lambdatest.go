@@ -0,0 +1,447 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+
+	"github.com/urfave/cli/v2"
+)
+
+const testUsage = "ol admin test --event <fixtures.json> [--expect <expectations.json>] [--junit <report.xml>] [-p <worker_path>] <directory>"
+
+// testEvent is one fixture to replay against the lambda.  The shape of the
+// resulting request mirrors what each trigger sends in production.
+type testEvent struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "http" (default), "cron", or "kafka"
+
+	// http
+	Method  string            `json:"method"`  // default POST
+	Path    string            `json:"path"`    // appended to /run/<lambda>
+	Headers map[string]string `json:"headers"` // extra request headers
+	Body    json.RawMessage   `json:"body"`    // a JSON string is sent as raw text
+
+	// kafka
+	Topic     string          `json:"topic"`
+	Partition int32           `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Value     json.RawMessage `json:"value"`    // a JSON string is sent as raw text
+	GroupId   string          `json:"group_id"` // default: that of the lambda's Kafka triggers
+}
+
+// testExpectation describes what a fixture's response must look like.
+// Unset fields are not checked, except that Status defaults to 200.
+type testExpectation struct {
+	Status       *int              `json:"status"`
+	Body         json.RawMessage   `json:"body"` // a JSON string must match the text exactly; anything else is compared as JSON
+	BodyContains string            `json:"body_contains"`
+	Headers      map[string]string `json:"headers"`
+}
+
+type testResult struct {
+	name     string
+	duration time.Duration
+	failures []string
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// rawPayload returns the bytes to send for a fixture body: JSON strings
+// are unwrapped so non-JSON payloads can be expressed, other values are
+// sent as-is.
+func rawPayload(msg json.RawMessage) []byte {
+	if len(msg) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(msg, &s); err == nil {
+		return []byte(s)
+	}
+	return msg
+}
+
+// loadTestEvents reads fixtures from a file containing either a single
+// event object or a list of them.  Unnamed events are named after the
+// file and their position.
+func loadTestEvents(path string) ([]testEvent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file %s: %v", path, err)
+	}
+
+	var events []testEvent
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var event testEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture file %s: %v", path, err)
+		}
+		events = []testEvent{event}
+	} else if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture file %s: %v", path, err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for i := range events {
+		if events[i].Name == "" {
+			events[i].Name = fmt.Sprintf("%s[%d]", base, i)
+		}
+	}
+	return events, nil
+}
+
+// buildFixtureRequest constructs the request a trigger would send to
+// /run/<funcName> for the given event.  The lambda is deployed as
+// funcName for the test, but lambdaName is what its triggers know it by.
+func buildFixtureRequest(baseURL string, funcName string, lambdaName string, event testEvent) (*http.Request, error) {
+	switch event.Type {
+	case "", "http":
+		method := event.Method
+		if method == "" {
+			method = "POST"
+		}
+		path := "/run/" + funcName + "/" + strings.TrimPrefix(event.Path, "/")
+		req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(rawPayload(event.Body)))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range event.Headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+
+	case "cron":
+		// same as boss/event CronScheduler.Invoke
+		return http.NewRequest("POST", baseURL+"/run/"+funcName, bytes.NewBufferString("{}"))
+
+	case "kafka":
+		// same as worker/event LambdaKafkaConsumer.processMessage
+		req, err := http.NewRequest("POST", baseURL+"/run/"+funcName+"/", bytes.NewReader(rawPayload(event.Value)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Kafka-Topic", event.Topic)
+		req.Header.Set("X-Kafka-Partition", fmt.Sprintf("%d", event.Partition))
+		req.Header.Set("X-Kafka-Offset", fmt.Sprintf("%d", event.Offset))
+		groupId := event.GroupId
+		if groupId == "" {
+			groupId = common.KafkaGroupId(lambdaName)
+		}
+		req.Header.Set("X-Kafka-Group-Id", groupId)
+		return req, nil
+	}
+
+	return nil, fmt.Errorf("unknown event type %q (expected http, cron, or kafka)", event.Type)
+}
+
+// checkExpectation returns a description of every way the response
+// differs from what was expected.
+func checkExpectation(expect testExpectation, status int, header http.Header, body []byte) []string {
+	failures := []string{}
+
+	wantStatus := http.StatusOK
+	if expect.Status != nil {
+		wantStatus = *expect.Status
+	}
+	if status != wantStatus {
+		failures = append(failures, fmt.Sprintf("status: expected %d, got %d", wantStatus, status))
+	}
+
+	keys := make([]string, 0, len(expect.Headers))
+	for k := range expect.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if got := header.Get(k); got != expect.Headers[k] {
+			failures = append(failures, fmt.Sprintf("header %s: expected %q, got %q", k, expect.Headers[k], got))
+		}
+	}
+
+	if len(expect.Body) > 0 {
+		var wantText string
+		if err := json.Unmarshal(expect.Body, &wantText); err == nil {
+			if got := strings.TrimRight(string(body), "\r\n"); got != wantText {
+				failures = append(failures, fmt.Sprintf("body: expected %q, got %q", wantText, got))
+			}
+		} else {
+			var want, got any
+			if err := json.Unmarshal(expect.Body, &want); err != nil {
+				failures = append(failures, fmt.Sprintf("body: bad expectation: %v", err))
+			} else if err := json.Unmarshal(body, &got); err != nil {
+				failures = append(failures, fmt.Sprintf("body: expected JSON %s, got non-JSON %q", string(expect.Body), string(body)))
+			} else if !reflect.DeepEqual(want, got) {
+				failures = append(failures, fmt.Sprintf("body: expected %s, got %s", string(expect.Body), strings.TrimSpace(string(body))))
+			}
+		}
+	}
+
+	if expect.BodyContains != "" && !strings.Contains(string(body), expect.BodyContains) {
+		failures = append(failures, fmt.Sprintf("body: expected to contain %q, got %q", expect.BodyContains, string(body)))
+	}
+
+	return failures
+}
+
+func runTestEvent(client *http.Client, baseURL string, funcName string, lambdaName string, event testEvent, expect testExpectation) testResult {
+	result := testResult{name: event.Name}
+	start := time.Now()
+	defer func() {
+		result.duration = time.Since(start)
+	}()
+
+	req, err := buildFixtureRequest(baseURL, funcName, lambdaName, event)
+	if err != nil {
+		result.failures = []string{err.Error()}
+		return result
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.failures = []string{fmt.Sprintf("request failed: %v", err)}
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		result.failures = []string{fmt.Sprintf("failed to read response: %v", err)}
+		return result
+	}
+
+	result.failures = checkExpectation(expect, resp.StatusCode, resp.Header, body)
+	result.duration = time.Since(start)
+	return result
+}
+
+func writeJUnitReport(out io.Writer, suiteName string, results []testResult) error {
+	suite := junitTestSuite{Name: suiteName, Tests: len(results)}
+	var total time.Duration
+
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.name,
+			Classname: suiteName,
+			Time:      fmt.Sprintf("%.3f", r.duration.Seconds()),
+		}
+		if len(r.failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: r.failures[0],
+				Text:    strings.Join(r.failures, "\n"),
+			}
+		}
+		total += r.duration
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// freePort asks the kernel for an unused TCP port.
+func freePort() (string, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// startEphemeralWorker brings up a detached worker at workerPath on a free
+// port, using the same `ol worker` commands a user would run.  The worker
+// dir (including the extracted base image) is kept for the next run; only
+// the process is ephemeral.
+func startEphemeralWorker(workerPath string, image string) (port string, stop func(), err error) {
+	olBin, err := os.Executable()
+	if err != nil {
+		return "", nil, err
+	}
+
+	port, err = freePort()
+	if err != nil {
+		return "", nil, fmt.Errorf("could not find a free port: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Starting ephemeral worker at %s on port %s\n", workerPath, port)
+	upCmd := exec.Command(olBin, "worker", "up", "-p", workerPath, "-i", image, "-o", "worker_port="+port, "-d")
+	upCmd.Stdout = os.Stderr
+	upCmd.Stderr = os.Stderr
+	if err := upCmd.Run(); err != nil {
+		return "", nil, fmt.Errorf("failed to start ephemeral worker: %v", err)
+	}
+
+	stop = func() {
+		downCmd := exec.Command(olBin, "worker", "down", "-p", workerPath)
+		downCmd.Stdout = os.Stderr
+		downCmd.Stderr = os.Stderr
+		if err := downCmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to stop ephemeral worker: %v\n", err)
+		}
+	}
+	return port, stop, nil
+}
+
+func adminTest(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	eventPaths := ctx.StringSlice("event")
+	if len(args) != 1 || len(eventPaths) == 0 {
+		return fmt.Errorf("usage: %s", testUsage)
+	}
+
+	funcDir := strings.TrimSuffix(args[0], "/")
+	if info, err := os.Stat(funcDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", funcDir)
+	}
+
+	events := []testEvent{}
+	for _, path := range eventPaths {
+		fileEvents, err := loadTestEvents(path)
+		if err != nil {
+			return err
+		}
+		events = append(events, fileEvents...)
+	}
+
+	expectations := make(map[string]testExpectation)
+	if path := ctx.String("expect"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read expectations file %s: %v", path, err)
+		}
+		if err := json.Unmarshal(data, &expectations); err != nil {
+			return fmt.Errorf("failed to parse expectations file %s: %v", path, err)
+		}
+	}
+	for name := range expectations {
+		found := false
+		for _, event := range events {
+			found = found || event.Name == name
+		}
+		if !found {
+			return fmt.Errorf("expectation %q does not match any fixture", name)
+		}
+	}
+
+	tarData, err := createTarGz(funcDir, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create tar.gz: %v", err)
+	}
+
+	// use the requested (or default) worker if it is up, else start one
+	port, err := targetPort(ctx, "worker", ctx.String("path"))
+	if err != nil {
+		if ctx.String("path") != "" {
+			return err
+		}
+		var stop func()
+		port, stop, err = startEphemeralWorker(ctx.String("ephemeral-path"), ctx.String("image"))
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	lambdaName := filepath.Base(funcDir)
+	funcName := fmt.Sprintf("test-%s-%s", lambdaName, hex.EncodeToString(suffix))
+	if err := common.ValidateFunctionName(funcName); err != nil {
+		return err
+	}
+
+	if err := uploadToLambdaStore(funcName, tarData, port); err != nil {
+		return fmt.Errorf("failed to deploy %s: %v", funcName, err)
+	}
+	defer func() {
+		if err := sendAdminRequest("DELETE", port, "/registry/"+funcName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", funcName, err)
+		}
+	}()
+
+	client := &http.Client{Timeout: ctx.Duration("timeout")}
+	baseURL := "http://localhost:" + port
+	results := []testResult{}
+	failed := 0
+
+	for _, event := range events {
+		result := runTestEvent(client, baseURL, funcName, lambdaName, event, expectations[event.Name])
+		results = append(results, result)
+
+		if len(result.failures) == 0 {
+			fmt.Fprintf(os.Stderr, "PASS %s (%v)\n", result.name, result.duration.Round(time.Millisecond))
+		} else {
+			failed++
+			fmt.Fprintf(os.Stderr, "FAIL %s (%v)\n", result.name, result.duration.Round(time.Millisecond))
+			for _, msg := range result.failures {
+				fmt.Fprintf(os.Stderr, "    %s\n", msg)
+			}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if path := ctx.String("junit"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create JUnit report: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeJUnitReport(out, filepath.Base(funcDir), results); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %v", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// TestBuildFixtureRequest verifies that each fixture type produces the
+// same request shape as the trigger it imitates.
+func TestBuildFixtureRequest(t *testing.T) {
+	kafka := testEvent{Type: "kafka", Topic: "orders", Partition: 2, Offset: 42, Value: json.RawMessage(`{"id": 1}`)}
+	req, err := buildFixtureRequest("http://localhost:5000", "f", "f", kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/run/f/" || req.Method != "POST" {
+		t.Errorf("unexpected kafka request %s %s", req.Method, req.URL.Path)
+	}
+	for k, v := range map[string]string{
+		"X-Kafka-Topic":     "orders",
+		"X-Kafka-Partition": "2",
+		"X-Kafka-Offset":    "42",
+		"X-Kafka-Group-Id":  "lambda-f",
+	} {
+		if got := req.Header.Get(k); got != v {
+			t.Errorf("expected %s=%q, got %q", k, v, got)
+		}
+	}
+
+	req, err = buildFixtureRequest("http://localhost:5000", "f", "f", testEvent{Type: "cron"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(strings.Builder)
+	req.Write(buf)
+	if req.URL.Path != "/run/f" || !strings.HasSuffix(buf.String(), "{}") {
+		t.Errorf("unexpected cron request: %q", buf.String())
+	}
+
+	httpEvent := testEvent{Method: "GET", Path: "/items/3", Body: json.RawMessage(`"plain text"`)}
+	req, err = buildFixtureRequest("http://localhost:5000", "f", "f", httpEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.URL.Path != "/run/f/items/3" || req.ContentLength != int64(len("plain text")) {
+		t.Errorf("unexpected http request %s %s (%d bytes)", req.Method, req.URL.Path, req.ContentLength)
+	}
+
+	if _, err := buildFixtureRequest("http://localhost:5000", "f", "f", testEvent{Type: "sqs"}); err == nil {
+		t.Errorf("expected error for unknown event type")
+	}
+}
+
+// TestFixtureKafkaGroupId verifies that Kafka fixtures carry the group
+// of the lambda's triggers, not that of its temporary test deployment,
+// unless the fixture names one.
+func TestFixtureKafkaGroupId(t *testing.T) {
+	for _, tc := range []struct {
+		groupId string
+		want    string
+	}{
+		{"", common.KafkaGroupId("orders")},
+		{"replayed", "replayed"},
+	} {
+		event := testEvent{Type: "kafka", Topic: "orders", GroupId: tc.groupId}
+		req, err := buildFixtureRequest("http://localhost:5000", "test-orders-1234", "orders", event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.Path != "/run/test-orders-1234/" {
+			t.Errorf("unexpected kafka request path %s", req.URL.Path)
+		}
+		if got := req.Header.Get("X-Kafka-Group-Id"); got != tc.want {
+			t.Errorf("expected X-Kafka-Group-Id=%q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestCheckExpectation(t *testing.T) {
+	created := 201
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	tests := []struct {
+		name     string
+		expect   testExpectation
+		status   int
+		body     string
+		failures int
+	}{
+		{"default expects 200", testExpectation{}, 200, "", 0},
+		{"default rejects 500", testExpectation{}, 500, "", 1},
+		{"explicit status", testExpectation{Status: &created}, 201, "", 0},
+		{"json body ignores formatting", testExpectation{Body: json.RawMessage(`{"a": [1, 2]}`)}, 200, "{\"a\":[1,2]}\n", 0},
+		{"json body mismatch", testExpectation{Body: json.RawMessage(`{"a": 1}`)}, 200, `{"a": 2}`, 1},
+		{"text body", testExpectation{Body: json.RawMessage(`"hello"`)}, 200, "hello\n", 0},
+		{"body contains", testExpectation{BodyContains: "ell"}, 200, "hello", 0},
+		{"header match", testExpectation{Headers: map[string]string{"content-type": "application/json"}}, 200, "", 0},
+		{"header mismatch", testExpectation{Headers: map[string]string{"X-Custom": "1"}}, 200, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkExpectation(tt.expect, tt.status, header, []byte(tt.body))
+			if len(failures) != tt.failures {
+				t.Errorf("expected %d failures, got %v", tt.failures, failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+
+	"github.com/urfave/cli/v2"
+)
+
+const recommendUsage = "ol admin recommend [-p <worker_path>] <lambda>"
+
+// adminRecommend prints the limits a worker recommends for a lambda,
+// based on the usage of its recent invocations there.
+func adminRecommend(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("usage: %s", recommendUsage)
+	}
+	lambdaName := ctx.Args().First()
+	if err := common.ValidateFunctionName(lambdaName); err != nil {
+		return err
+	}
+
+	port, err := targetPort(ctx, "worker", ctx.String("path"))
+	if err != nil {
+		return err
+	}
+
+	reqURL := fmt.Sprintf("http://localhost:%s/recommendations?lambda=%s", port, url.QueryEscape(lambdaName))
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(reqURL)
+	if err != nil {
+		return fmt.Errorf("failed to get recommendations: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read recommendations: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("worker returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var recs []common.Recommendation
+	if err := json.Unmarshal(body, &recs); err != nil {
+		return fmt.Errorf("bad recommendations from worker: %v", err)
+	}
+	if len(recs) != 1 {
+		return fmt.Errorf("expected 1 recommendation from worker, got %d", len(recs))
+	}
+	rec := recs[0]
+
+	fmt.Printf("Lambda %s (%d recent invocations with measured usage)\n", rec.Lambda, rec.Samples)
+	if rec.Samples > 0 {
+		p := rec.MemPeakMB
+		fmt.Printf("  peak memory (MB):      p50=%d p95=%d p99=%d max=%d\n", p.P50, p.P95, p.P99, p.Max)
+		p = rec.CPUUsedPercent
+		fmt.Printf("  CPU used (%% of core):  p50=%d p95=%d p99=%d max=%d\n", p.P50, p.P95, p.P99, p.Max)
+	}
+
+	if rec.Mem_mb == 0 {
+		fmt.Printf("No recommendation: %s\n", rec.Note)
+		return nil
+	}
+
+	fmt.Printf("Recommended: mem_mb=%d cpu_percent=%d\n", rec.Mem_mb, rec.CPU_percent)
+	if rec.Applied {
+		fmt.Printf("New sandboxes for %s already start with these limits.\n", rec.Lambda)
+	} else {
+		fmt.Printf("Not applied: %s\n", rec.Note)
+	}
+	return nil
+}
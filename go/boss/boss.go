@@ -24,12 +24,22 @@ const (
 	SCALING_PATH     = "/scaling/worker_count"
 	SHUTDOWN_PATH    = "/shutdown"
 
-	// GET /registry
+	// GET /usage: per-lambda, per-hour resource usage, summed across
+	// running workers
+	USAGE_PATH = "/usage"
+
+	// GET /registry (?digests=true for name -> sha256 of tarball)
 	// POST /registry/{name}
 	// DELETE /registry/{name}
 	// GET /registry/{name} not implemented
 	// GET /registry/{name}/config
+	// PATCH /registry/{name}/config (merge a partial ol.yaml into the config overlay)
+	// DELETE /registry/{name}/config (drop the config overlay)
 	REGISTRY_BASE_PATH = "/registry/"
+
+	// PUT /secrets/{name} (body is the value; encrypted at rest)
+	// DELETE /secrets/{name}
+	SECRETS_PATH = "/secrets/"
 )
 
 type Boss struct {
@@ -58,6 +68,22 @@ func (boss *Boss) BossStatus(w http.ResponseWriter, req *http.Request) {
 	w.Write(b)
 }
 
+// Usage handles the request to get the resource usage of lambdas.
+func (boss *Boss) Usage(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.MarshalIndent(boss.workerPool.CollectUsage(), "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
 // Close handles the request to close the boss.
 func (b *Boss) Close(_ http.ResponseWriter, _ *http.Request) {
 	b.workerPool.Close()
@@ -117,7 +143,7 @@ func (b *Boss) RegistryHandler(w http.ResponseWriter, r *http.Request) {
 	// GET /registry - list all lambda functions in registry
 	if relPath == "" {
 		if r.Method == "GET" {
-			b.lambdaStore.ListLambda(w)
+			b.lambdaStore.ListLambda(w, r)
 			return
 		}
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -126,9 +152,18 @@ func (b *Boss) RegistryHandler(w http.ResponseWriter, r *http.Request) {
 
 	parts := strings.SplitN(relPath, "/", 2)
 
-	// GET /registry/{name}/config
-	if len(parts) == 2 && parts[1] == "config" && r.Method == "GET" {
-		b.lambdaStore.RetrieveLambdaConfig(w, r)
+	// GET|PATCH|DELETE /registry/{name}/config
+	if len(parts) == 2 && parts[1] == "config" {
+		switch r.Method {
+		case "GET":
+			b.lambdaStore.RetrieveLambdaConfig(w, r)
+		case "PATCH":
+			b.lambdaStore.PatchLambdaConfig(w, r)
+		case "DELETE":
+			b.lambdaStore.DeleteLambdaConfigOverlay(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
 		return
 	}
 
@@ -158,6 +193,11 @@ func BossMain() (err error) {
 		return err
 	}
 
+	// before any worker starts, as local workers share this key
+	if err := store.EnableSecrets(config.BossConf.Secrets_key_file); err != nil {
+		return err
+	}
+
 	boss := Boss{
 		workerPool:  pool,
 		lambdaStore: store,
@@ -176,8 +216,10 @@ func BossMain() (err error) {
 	http.HandleFunc(SCALING_PATH, boss.ScalingWorker)
 	http.HandleFunc(RUN_PATH, boss.workerPool.RunLambda)
 	http.HandleFunc(SHUTDOWN_PATH, boss.Close)
+	http.HandleFunc(USAGE_PATH, boss.Usage)
 
 	http.HandleFunc(REGISTRY_BASE_PATH, boss.RegistryHandler)
+	http.HandleFunc(SECRETS_PATH, boss.lambdaStore.SecretsHandler)
 
 	// clean up if signal hits us
 	c := make(chan os.Signal, 1)
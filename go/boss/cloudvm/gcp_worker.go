@@ -161,6 +161,9 @@ func createGcsTemplate() error {
 	defaultTemplateConfig.SOCK_base_path = ""
 	defaultTemplateConfig.Import_cache_tree = ""
 	defaultTemplateConfig.Worker_url = "0.0.0.0"
+	// workers default to <ol dir>/secrets.key, so the boss's key must be
+	// copied there for them to read secrets
+	defaultTemplateConfig.Secrets_key_file = ""
 
 	// Save template.json with GCS registry
 	if err := common.SaveConfig(defaultTemplateConfig, templatePath); err != nil {
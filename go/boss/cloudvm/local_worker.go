@@ -39,6 +39,11 @@ func NewLocalWorkerPool() *WorkerPool {
 			defaultTemplateConfig.Registry = config.BossConf.GetLambdaStoreURL()
 			slog.Info("Setting template.json registry", "registry", defaultTemplateConfig.Registry)
 
+			// local workers decrypt secrets with the boss's own key
+			if keyFile, err := filepath.Abs(config.BossConf.Secrets_key_file); err == nil {
+				defaultTemplateConfig.Secrets_key_file = keyFile
+			}
+
 			// Clear worker-specific fields so they get patched later
 			defaultTemplateConfig.Worker_dir = ""
 			defaultTemplateConfig.Pkgs_dir = ""
@@ -103,6 +108,11 @@ func (p *LocalWorkerPoolPlatform) CreateInstance(worker *Worker) error {
 	// Set worker-specific port
 	cfg.Worker_port = workerPort
 
+	// isolated sandboxes of workers on the same host need disjoint addresses
+	port, _ := strconv.Atoi(workerPort)
+	startPort, _ := strconv.Atoi(config.BossConf.Local.Worker_Starting_Port)
+	cfg.Network.Subnet = fmt.Sprintf("10.%d.0.0/16", 200+(port-startPort)%56)
+
 	// Save to worker directory
 	configPath := filepath.Join(workerPath, "config.json")
 	if err := common.SaveConfig(cfg, configPath); err != nil {
@@ -1,6 +1,7 @@
 package cloudvm
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -8,8 +9,11 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
 )
 
 func NewWorkerPool(platform string, worker_cap int) (*WorkerPool, error) {
@@ -328,6 +332,123 @@ func (pool *WorkerPool) RunLambda(w http.ResponseWriter, r *http.Request) {
 	atomic.AddInt64(&pool.nLatency, 1)
 }
 
+// InvalidateLambda tells every running worker that funcName was replaced
+// or deleted, so they stop serving their cached copy of the code.  A
+// worker that misses the message still notices new code once its
+// Registry_cache_ms window has passed.
+func (pool *WorkerPool) InvalidateLambda(funcName string, deleted bool) {
+	pool.Lock()
+	workers := make([]*Worker, 0, len(pool.workers[RUNNING]))
+	for _, worker := range pool.workers[RUNNING] {
+		workers = append(workers, worker)
+	}
+	pool.Unlock()
+
+	method := http.MethodPost
+	if deleted {
+		method = http.MethodDelete
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *Worker) {
+			defer wg.Done()
+
+			address, err := GetWorkerAddress(worker)
+			if err != nil {
+				slog.Error(fmt.Sprintf("cannot invalidate %s on worker %s: %v", funcName, worker.workerId, err))
+				return
+			}
+
+			// see INVALIDATE_PATH in worker/event
+			url := fmt.Sprintf("http://%s/invalidate/%s", address, funcName)
+			req, err := http.NewRequest(method, url, nil)
+			if err != nil {
+				slog.Error(fmt.Sprintf("cannot invalidate %s on worker %s: %v", funcName, worker.workerId, err))
+				return
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				slog.Error(fmt.Sprintf("cannot invalidate %s on worker %s: %v", funcName, worker.workerId, err))
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				slog.Error(fmt.Sprintf("worker %s rejected invalidation of %s: %s - %s", worker.workerId, funcName, resp.Status, string(body)))
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
+
+// CollectUsage gathers the usage ledgers (see USAGE_PATH in
+// worker/event) of all running workers, summed per lambda and hour.
+// Workers that can't be reached are logged and left out.
+func (pool *WorkerPool) CollectUsage() []common.UsageRecord {
+	pool.Lock()
+	workers := make([]*Worker, 0, len(pool.workers[RUNNING]))
+	for _, worker := range pool.workers[RUNNING] {
+		workers = append(workers, worker)
+	}
+	pool.Unlock()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var mutex sync.Mutex
+	var records []common.UsageRecord
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *Worker) {
+			defer wg.Done()
+
+			workerRecords, err := getWorkerUsage(client, worker)
+			if err != nil {
+				slog.Error(fmt.Sprintf("cannot collect usage from worker %s: %v", worker.workerId, err))
+				return
+			}
+
+			mutex.Lock()
+			records = append(records, workerRecords...)
+			mutex.Unlock()
+		}(worker)
+	}
+	wg.Wait()
+
+	return common.SumUsage(records)
+}
+
+func getWorkerUsage(client *http.Client, worker *Worker) ([]common.UsageRecord, error) {
+	address, err := GetWorkerAddress(worker)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/usage", address))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s - %s", resp.Status, string(body))
+	}
+
+	var records []common.UsageRecord
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
 // force kill workers
 func (pool *WorkerPool) Close() {
 	slog.Info("closing worker pool")
@@ -428,6 +549,12 @@ func forwardTaskHelper(w http.ResponseWriter, req *http.Request, workerHost stri
 	}
 	defer resp.Body.Close()
 
+	// e.g., the X-OL-* usage headers
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
 	io.Copy(w, resp.Body)
 
 	return nil
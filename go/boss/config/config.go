@@ -17,6 +17,9 @@ type Config struct {
 	Worker_Cap int             `json:"worker_cap"`
 	Gcp        GcpConfig       `json:"gcp"`
 	Local      LocalPlatConfig `json:"local"`
+
+	// master key for the secrets the boss stores in the lambda store
+	Secrets_key_file string `json:"secrets_key_file"`
 }
 
 func LoadDefaults() error {
@@ -28,6 +31,8 @@ func LoadDefaults() error {
 		Worker_Cap: 4,
 		Gcp:        GetGcpConfigDefaults(),
 		Local:      GetLocalPlatformConfigDefaults(),
+
+		Secrets_key_file: "secrets.key",
 	}
 
 	return checkConf()
@@ -54,6 +59,11 @@ func checkConf() error {
 		return fmt.Errorf("Scaling type '%s' not implemented", BossConf.Scaling)
 	}
 
+	// boss.json files from before secrets existed don't set this
+	if BossConf.Secrets_key_file == "" {
+		BossConf.Secrets_key_file = "secrets.key"
+	}
+
 	return nil
 }
 
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadConfOld verifies that a boss.json from before secrets
+// existed still gets a key file.
+func TestLoadConfOld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boss.json")
+	old := `{"platform": "local", "scaling": "manual", "api_key": "abc", "boss_port": "5000", "worker_cap": 4}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConf(path); err != nil {
+		t.Fatal(err)
+	}
+	if BossConf.Secrets_key_file != "secrets.key" {
+		t.Errorf("expected default secrets_key_file, got %q", BossConf.Secrets_key_file)
+	}
+}
@@ -0,0 +1,95 @@
+package lambdastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gocloud.dev/gcerrors"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// secrets are small (passwords, tokens, certificates)
+const maxSecretBytes = 64 * 1024
+
+// EnableSecrets loads (or creates) the master key used to encrypt secrets.
+// Until this is called, the secret handlers refuse all requests.
+func (s *LambdaStore) EnableSecrets(keyPath string) error {
+	key, err := common.LoadSecretKey(keyPath)
+	if err != nil {
+		return err
+	}
+	s.secretKey = key
+	return nil
+}
+
+// SecretsHandler handles PUT /secrets/{name} (body is the secret value)
+// and DELETE /secrets/{name}.  Secrets can never be read back over HTTP;
+// they are only resolved into the sandboxes of lambdas that reference them.
+func (s *LambdaStore) SecretsHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/secrets/")
+	if err := common.ValidateSecretName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.secretKey == nil {
+		http.Error(w, "no secret key configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		s.putSecret(w, r, name)
+	case "DELETE":
+		s.deleteSecret(w, name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *LambdaStore) putSecret(w http.ResponseWriter, r *http.Request, name string) {
+	value, err := io.ReadAll(io.LimitReader(r.Body, maxSecretBytes+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read secret: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(value) > maxSecretBytes {
+		http.Error(w, fmt.Sprintf("secret exceeds %d bytes", maxSecretBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := common.EncryptSecret(s.secretKey, name, value)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encrypt secret: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.bucket.WriteAll(context.Background(), common.SecretKeyPrefix+name, data, nil); err != nil {
+		http.Error(w, fmt.Sprintf("failed to store secret: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Stored secret %s", name))
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Secret %s stored successfully", name)
+}
+
+func (s *LambdaStore) deleteSecret(w http.ResponseWriter, name string) {
+	err := s.bucket.Delete(context.Background(), common.SecretKeyPrefix+name)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		http.Error(w, fmt.Sprintf("secret %s not found", name), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete secret: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Deleted secret %s", name))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Secret %s deleted successfully", name)
+}
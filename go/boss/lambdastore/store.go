@@ -2,7 +2,10 @@ package lambdastore
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -15,6 +18,8 @@ import (
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
+	"gopkg.in/yaml.v3"
 
 	"github.com/open-lambda/open-lambda/go/boss/cloudvm"
 	"github.com/open-lambda/open-lambda/go/boss/event"
@@ -26,13 +31,34 @@ type LambdaStore struct {
 	bucket *blob.Bucket
 
 	eventManager *event.Manager
+
+	// changeHook, if set, is called after a lambda's code is replaced or
+	// the lambda is deleted, so whoever runs it can drop cached code
+	changeHook func(funcName string, deleted bool)
+
+	// secretKey encrypts the secrets stored next to the lambdas (nil
+	// until EnableSecrets is called)
+	secretKey []byte
+
 	// mapLock protects concurrent access to the Lambdas map
 	mapLock sync.Mutex
 	Lambdas map[string]*LambdaEntry
 }
 
+var errLambdaNotFound = errors.New("lambda not found")
+var errInvalidOverlay = errors.New("invalid config overlay")
+
 type LambdaEntry struct {
+	// Config is the effective config: the ol.yaml from the tarball with
+	// any config overlay applied
 	Config *common.LambdaConfig
+	// baseConfig is the config from the tarball alone, and overlay is
+	// the accumulated PATCHes to it (nil if none)
+	baseConfig *common.LambdaConfig
+	overlay    map[string]any
+	// Digest is the hex sha256 of the stored tarball, used by clients
+	// (e.g., `ol admin apply`) to skip re-uploading unchanged code
+	Digest string
 	Lock   *sync.Mutex
 }
 
@@ -70,13 +96,21 @@ func NewLambdaStore(storeURL string, pool *cloudvm.WorkerPool) (*LambdaStore, er
 	}
 
 	var eventManager *event.Manager
+	var changeHook func(string, bool)
 	if pool != nil {
 		eventManager = event.NewManager(pool)
+		// workers may be slow or unreachable, so uploads and
+		// deletes don't wait for them (any that miss the message
+		// still pick up the change within Registry_cache_ms)
+		changeHook = func(funcName string, deleted bool) {
+			go pool.InvalidateLambda(funcName, deleted)
+		}
 	}
 
 	store := &LambdaStore{
 		bucket:       bucket,
 		eventManager: eventManager,
+		changeHook:   changeHook,
 		Lambdas:      make(map[string]*LambdaEntry),
 	}
 
@@ -115,6 +149,7 @@ func (s *LambdaStore) UploadLambda(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to add lambda: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.notifyChange(funcName, false)
 
 	w.WriteHeader(http.StatusCreated)
 	fmt.Fprintf(w, "Lambda %s uploaded successfully", funcName)
@@ -132,15 +167,23 @@ func (s *LambdaStore) DeleteLambda(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.notifyChange(funcName, true)
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Lambda %s deleted successfully", funcName)
 }
 
-func (s *LambdaStore) ListLambda(w http.ResponseWriter) {
-	funcNames := s.ListEntries()
+// ListLambda writes a JSON list of lambda names.  With ?digests=true, it
+// instead writes a JSON object mapping each name to its tarball digest.
+func (s *LambdaStore) ListLambda(w http.ResponseWriter, r *http.Request) {
+	var body any
+	if r.URL.Query().Get("digests") == "true" {
+		body = s.ListDigests()
+	} else {
+		body = s.ListEntries()
+	}
 
-	if err := json.NewEncoder(w).Encode(funcNames); err != nil {
+	if err := json.NewEncoder(w).Encode(body); err != nil {
 		http.Error(w, "failed to encode lambda list", http.StatusInternalServerError)
 	}
 }
@@ -168,14 +211,111 @@ func (s *LambdaStore) RetrieveLambdaConfig(w http.ResponseWriter, r *http.Reques
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+	if err := json.NewEncoder(w).Encode(cfg.Redacted()); err != nil {
 		http.Error(w, "failed to encode config as JSON", http.StatusInternalServerError)
 		return
 	}
 }
 
+// PatchLambdaConfig merges a partial LambdaConfig (YAML or JSON body) into
+// the lambda's config overlay, e.g.:
+//
+// curl -X PATCH localhost:5000/registry/<name>/config -d '{"environment": {"LEVEL": "debug"}}'
+//
+// Nested maps merge key by key, lists replace, and null deletes a key.
+// The overlay persists across code uploads until it is deleted.
+func (s *LambdaStore) PatchLambdaConfig(w http.ResponseWriter, r *http.Request) {
+	funcName, ok := configPathName(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	patch, err := common.ParseLambdaConfigOverlay(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeConfigUpdate(w, funcName, func(overlay map[string]any) map[string]any {
+		return common.MergeLambdaConfigOverlays(overlay, patch)
+	})
+}
+
+// DeleteLambdaConfigOverlay drops the lambda's config overlay, reverting
+// to the ol.yaml in its code.
+func (s *LambdaStore) DeleteLambdaConfigOverlay(w http.ResponseWriter, r *http.Request) {
+	funcName, ok := configPathName(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeConfigUpdate(w, funcName, func(map[string]any) map[string]any {
+		return nil
+	})
+}
+
+// configPathName extracts {name} from /registry/{name}/config, replying
+// with an error if the path is malformed.
+func configPathName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	raw := strings.TrimPrefix(r.URL.Path, "/registry/")
+	parts := strings.SplitN(raw, "/", 2)
+
+	if len(parts) != 2 || parts[1] != "config" {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return "", false
+	}
+
+	if err := common.ValidateFunctionName(parts[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+func (s *LambdaStore) writeConfigUpdate(w http.ResponseWriter, funcName string, update func(map[string]any) map[string]any) {
+	cfg, err := s.updateOverlay(funcName, update)
+	if errors.Is(err, errLambdaNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, errInvalidOverlay) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.notifyChange(funcName, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cfg.Redacted()); err != nil {
+		http.Error(w, "failed to encode config as JSON", http.StatusInternalServerError)
+	}
+}
+
 // ------------------- Core Logic ----------------------
 
+// SetChangeHook registers a function to call after a lambda is uploaded
+// (deleted=false) or deleted (deleted=true).  The hook runs before the
+// request is answered.  A boss store notifies its workers by default (in
+// the background); a worker that owns its registry uses this to
+// invalidate its own lambdas.
+func (s *LambdaStore) SetChangeHook(hook func(funcName string, deleted bool)) {
+	s.changeHook = hook
+}
+
+func (s *LambdaStore) notifyChange(funcName string, deleted bool) {
+	if s.changeHook != nil {
+		s.changeHook(funcName, deleted)
+	}
+}
+
 func (s *LambdaStore) loadConfigAndRegister(funcName string) error {
 	ctx := context.Background()
 	key := funcName + common.LambdaFileExtension
@@ -195,21 +335,30 @@ func (s *LambdaStore) loadConfigAndRegister(funcName string) error {
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	if _, err := io.Copy(tempFile, reader); err != nil {
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tempFile, hash), reader); err != nil {
 		return fmt.Errorf("failed to download blob: %w", err)
 	}
 
-	cfg, err := common.ExtractConfigFromTarGz(tempFile.Name())
+	baseCfg, err := common.ExtractConfigFromTarGz(tempFile.Name())
 	if err != nil {
 		return fmt.Errorf("failed to extract config.json: %w", err)
 	}
 
+	overlay, cfg, err := s.loadOverlay(funcName, baseCfg)
+	if err != nil {
+		return err
+	}
+
 	entry := s.getOrCreateEntry(funcName)
 
 	entry.Lock.Lock()
 	defer entry.Lock.Unlock()
 
 	entry.Config = cfg
+	entry.baseConfig = baseCfg
+	entry.overlay = overlay
+	entry.Digest = hex.EncodeToString(hash.Sum(nil))
 
 	if s.eventManager != nil {
 		err = s.eventManager.Register(funcName, cfg.Triggers)
@@ -238,7 +387,8 @@ func (s *LambdaStore) addToRegistry(funcName string, body io.Reader) error {
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	if _, err := io.Copy(tempFile, body); err != nil {
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tempFile, hash), body); err != nil {
 		return fmt.Errorf("failed to write to temp tarball: %w", err)
 	}
 
@@ -246,11 +396,17 @@ func (s *LambdaStore) addToRegistry(funcName string, body io.Reader) error {
 		return fmt.Errorf("failed to close temp tarball: %w", err)
 	}
 
-	cfg, err := common.ExtractConfigFromTarGz(tempFile.Name())
+	baseCfg, err := common.ExtractConfigFromTarGz(tempFile.Name())
 	if err != nil {
 		return fmt.Errorf("failed to extract config from temp tarball: %w", err)
 	}
 
+	// an existing overlay must still apply to the new code's ol.yaml
+	overlay, cfg, err := s.loadOverlay(funcName, baseCfg)
+	if err != nil {
+		return err
+	}
+
 	// Upload to blob storage
 	tempFile, err = os.Open(tempFile.Name())
 	if err != nil {
@@ -276,6 +432,9 @@ func (s *LambdaStore) addToRegistry(funcName string, body io.Reader) error {
 	}
 
 	lambdaEntry.Config = cfg
+	lambdaEntry.baseConfig = baseCfg
+	lambdaEntry.overlay = overlay
+	lambdaEntry.Digest = hex.EncodeToString(hash.Sum(nil))
 
 	if s.eventManager != nil {
 		err = s.eventManager.Register(funcName, cfg.Triggers)
@@ -312,19 +471,99 @@ func (s *LambdaStore) removeFromRegistry(funcName string) error {
 		if err := s.bucket.Delete(context.Background(), funcName+common.LambdaFileExtension); err != nil {
 			slog.Error(fmt.Sprintf("warning: failed to remove %s from blob storage: %v", funcName+common.LambdaFileExtension, err))
 		}
+		overlayKey := funcName + common.LambdaConfigOverlayExtension
+		if err := s.bucket.Delete(context.Background(), overlayKey); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			slog.Error(fmt.Sprintf("warning: failed to remove %s from blob storage: %v", overlayKey, err))
+		}
 	}()
 
 	return nil
 }
 
-func (s *LambdaStore) GetConfig(funcName string) (*common.LambdaConfig, error) {
-	lambdaEntry := s.getOrCreateEntry(funcName)
-	lambdaEntry.Lock.Lock()
-	defer lambdaEntry.Lock.Unlock()
+// loadOverlay reads the stored config overlay of a lambda (if any) and
+// applies it to baseCfg.
+func (s *LambdaStore) loadOverlay(funcName string, baseCfg *common.LambdaConfig) (map[string]any, *common.LambdaConfig, error) {
+	key := funcName + common.LambdaConfigOverlayExtension
+	data, err := s.bucket.ReadAll(context.Background(), key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, baseCfg, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config overlay: %w", err)
+	}
+
+	overlay, err := common.ParseLambdaConfigOverlay(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := common.ApplyLambdaConfigOverlay(baseCfg, overlay)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stored config overlay for %s does not apply: %w", funcName, err)
+	}
+	return overlay, cfg, nil
+}
+
+// updateOverlay replaces a lambda's overlay with update(current overlay),
+// persists it, and re-registers the lambda's triggers.  A nil overlay
+// removes the stored one.
+func (s *LambdaStore) updateOverlay(funcName string, update func(map[string]any) map[string]any) (*common.LambdaConfig, error) {
+	s.mapLock.Lock()
+	entry, ok := s.Lambdas[funcName]
+	s.mapLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errLambdaNotFound, funcName)
+	}
+
+	entry.Lock.Lock()
+	defer entry.Lock.Unlock()
 
-	// Return cached config if available
-	if lambdaEntry.Config != nil {
-		return lambdaEntry.Config, nil
+	if entry.baseConfig == nil {
+		return nil, fmt.Errorf("%w: %s", errLambdaNotFound, funcName)
+	}
+
+	overlay := update(entry.overlay)
+	cfg := entry.baseConfig
+	ctx := context.Background()
+	key := funcName + common.LambdaConfigOverlayExtension
+
+	if overlay == nil {
+		if err := s.bucket.Delete(ctx, key); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			return nil, fmt.Errorf("failed to delete config overlay: %w", err)
+		}
+	} else {
+		var err error
+		cfg, err = common.ApplyLambdaConfigOverlay(entry.baseConfig, overlay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidOverlay, err)
+		}
+
+		data, err := yaml.Marshal(overlay)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode config overlay: %w", err)
+		}
+		if err := s.bucket.WriteAll(ctx, key, data, nil); err != nil {
+			return nil, fmt.Errorf("failed to store config overlay: %w", err)
+		}
+	}
+
+	entry.overlay = overlay
+	entry.Config = cfg
+
+	if s.eventManager != nil {
+		if err := s.eventManager.Register(funcName, cfg.Triggers); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// GetConfig returns the effective config of a lambda, loading it from
+// blob storage if it is not cached.  It does not add an entry for a
+// lambda that does not exist.
+func (s *LambdaStore) GetConfig(funcName string) (*common.LambdaConfig, error) {
+	if cfg := s.cachedConfig(funcName); cfg != nil {
+		return cfg, nil
 	}
 
 	// If not cached, try to load from blob storage
@@ -332,7 +571,26 @@ func (s *LambdaStore) GetConfig(funcName string) (*common.LambdaConfig, error) {
 		return nil, fmt.Errorf("failed to load lambda %q: %w", funcName, err)
 	}
 
-	return lambdaEntry.Config, nil
+	cfg := s.cachedConfig(funcName)
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: %s", errLambdaNotFound, funcName)
+	}
+	return cfg, nil
+}
+
+// cachedConfig returns the config of a lambda, or nil if it has none
+// (yet).
+func (s *LambdaStore) cachedConfig(funcName string) *common.LambdaConfig {
+	s.mapLock.Lock()
+	entry, ok := s.Lambdas[funcName]
+	s.mapLock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	entry.Lock.Lock()
+	defer entry.Lock.Unlock()
+	return entry.Config
 }
 
 func (s *LambdaStore) getOrCreateEntry(funcName string) *LambdaEntry {
@@ -361,3 +619,27 @@ func (s *LambdaStore) ListEntries() []string {
 	}
 	return funcNames
 }
+
+// ListDigests returns the tarball digest of every lambda that has been
+// loaded.
+func (s *LambdaStore) ListDigests() map[string]string {
+	// entries are locked during uploads, so copy them out rather
+	// than holding mapLock while waiting for one
+	s.mapLock.Lock()
+	entries := make(map[string]*LambdaEntry, len(s.Lambdas))
+	for name, entry := range s.Lambdas {
+		entries[name] = entry
+	}
+	s.mapLock.Unlock()
+
+	digests := make(map[string]string, len(entries))
+	for name, entry := range entries {
+		entry.Lock.Lock()
+		// a failed upload leaves an entry without a config
+		if entry.Config != nil {
+			digests[name] = entry.Digest
+		}
+		entry.Lock.Unlock()
+	}
+	return digests
+}
@@ -0,0 +1,66 @@
+package lambdastore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sync"
+	"testing"
+)
+
+// lambdaTarball returns a .tar.gz holding just an ol.yaml
+func lambdaTarball(t *testing.T, olYaml string) []byte {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	if err := tw.WriteHeader(&tar.Header{Name: "ol.yaml", Mode: 0644, Size: int64(len(olYaml))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(olYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestListDigests verifies that digests can be listed during uploads,
+// and that lookups of missing lambdas don't show up in the list.
+func TestListDigests(t *testing.T) {
+	store, err := NewLambdaStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetConfig("missing"); err == nil {
+		t.Errorf("expected an error for a lambda that was never uploaded")
+	}
+
+	tarball := lambdaTarball(t, "reuse-sandbox: true\n")
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := store.addToRegistry(name, bytes.NewReader(tarball)); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	for i := 0; i < 10; i++ {
+		store.ListDigests()
+	}
+	wg.Wait()
+
+	digests := store.ListDigests()
+	if len(digests) != 2 || digests["a"] == "" || digests["a"] != digests["b"] {
+		t.Errorf("expected matching digests for a and b only, got %v", digests)
+	}
+	if _, err := store.GetConfig("a"); err != nil {
+		t.Error(err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log/slog"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/urfave/cli/v2"
@@ -30,7 +32,14 @@ type Config struct {
 	// log output of the runtime and proxy?
 	Log_output bool `json:"log_output"`
 
-	// sandbox type: "docker" or "sock"
+	// keep each sandbox's runtime output in ol-runtime.log in its
+	// scratch dir (for `ol admin dev`), rather than the worker's own
+	// output.  The log is cut back once it passes this many KB (with
+	// the previous part kept in ol-runtime.log.1).  0 disables it.
+	Runtime_log_kb int `json:"runtime_log_kb"`
+
+	// sandbox type: "docker", "sock", or "process" (unprivileged, but
+	// NOT isolated; for development only)
 	// currently ignored as cgroup sandbox is not fully integrated
 	Sandbox string `json:"sandbox"`
 
@@ -43,6 +52,10 @@ type Config struct {
 	// how long should some previously pulled code be used without a check for a newer version?
 	Registry_cache_ms int `json:"registry_cache_ms"`
 
+	// master key for secrets in the registry (created if missing).  Must
+	// match the key of whoever else writes secrets to the same registry.
+	Secrets_key_file string `json:"secrets_key_file"`
+
 	// directory to install packages to, that sandboxes will read from
 	Pkgs_dir string
 
@@ -52,6 +65,11 @@ type Config struct {
 	// CACHE OPTIONS
 	Mem_pool_mb int `json:"mem_pool_mb"`
 
+	// how long a sandbox being shut down (on scale-down or code
+	// updates, but not evictions) gets to exit before it is killed.
+	// 0 kills sandboxes right away.
+	Shutdown_grace_ms int `json:"shutdown_grace_ms"`
+
 	// can be empty (use root zygote only), a JSON obj (specifying
 	// the tree), or a path (to a file specifying the tree)
 	Import_cache_tree any `json:"import_cache_tree"`
@@ -69,6 +87,38 @@ type Config struct {
 	Trace           TraceConfig    `json:"trace"`
 	Storage         StorageConfig  `json:"storage"`
 	Kafka           KafkaConfig    `json:"kafka"`
+	Network         NetworkConfig  `json:"network"`
+	Seccomp         SeccompConfig  `json:"seccomp"`
+	Rootless        RootlessConfig `json:"rootless"`
+	Evictor         EvictorConfig  `json:"evictor"`
+
+	Mem_overcommit OvercommitConfig  `json:"mem_overcommit"`
+	Rightsizing    RightsizingConfig `json:"rightsizing"`
+	CPU            CPUConfig         `json:"cpu"`
+	Priority       PriorityConfig    `json:"priority"`
+
+	// named directories on the worker that lambdas may mount (see
+	// VolumeMount in ol.yaml)
+	Volumes map[string]VolumeConfig `json:"volumes"`
+
+	// more base images for lambdas to pick from in ol.yaml (the
+	// default image is made of SOCK_base_path, Pkgs_dir and
+	// Docker.Base_image)
+	Images map[string]ImageConfig `json:"images"`
+}
+
+// name of the image described by the top-level config fields
+const DEFAULT_IMAGE = "default"
+
+type ImageConfig struct {
+	// root file system for SOCK sandboxes
+	SOCK_base_path string `json:"sock_base_path"`
+	// image for Docker sandboxes
+	Docker_image string `json:"docker_image"`
+	// where packages are installed for this image (they must match its
+	// Python version).  SOCK sandboxes see <sock_base_path>/packages,
+	// which is the default.
+	Pkgs_dir string `json:"pkgs_dir"`
 }
 
 type KafkaConfig struct {
@@ -84,6 +134,184 @@ type KafkaConfig struct {
 	Poll_timeout_sec int `json:"poll_timeout_sec"`
 }
 
+type NetworkConfig struct {
+	// network mode for lambdas whose ol.yaml has no network section
+	// ("host", "none", or "loopback"; see NetworkPolicy)
+	Default_mode string `json:"default_mode"`
+	// IPv4 range for sandboxes in "egress" mode, split into a /30 per
+	// sandbox.  Workers on the same host need disjoint subnets.
+	Subnet string `json:"subnet"`
+}
+
+// RootlessConfig lets the SOCK sandbox run without root.  The worker
+// re-executes itself in new user and mount namespaces, where it is root
+// (mapped to the invoking user), so it can mount and chroot for its
+// sandboxes, and it takes cgroups from a subtree delegated to that user.
+type RootlessConfig struct {
+	Enabled bool `json:"enabled"`
+	// delegated cgroup v2 directory, writable by the worker's user (e.g.,
+	// from `systemd-run --user -p Delegate=yes`).  The worker moves
+	// itself to a "worker" leaf, and creates the sandbox pool next to it.
+	Cgroup_root string `json:"cgroup_root"`
+}
+
+// EvictorConfig controls how the SOCK evictor frees memory (zero fields
+// mean the built-in defaults)
+type EvictorConfig struct {
+	// which idle sandboxes to evict first: "lru" (the default), "lfu",
+	// or "cost" (cheapest to re-create per MB freed)
+	Policy string `json:"policy"`
+	// percent of the memory pool (beyond two sandboxes) to keep free for
+	// new sandboxes (default 20)
+	Free_percent int `json:"free_percent"`
+	// how many evictions may be in flight at once (default 8)
+	Concurrent int `json:"concurrent"`
+}
+
+// RightsizingConfig controls the memory and CPU limits the worker
+// recommends for each lambda from what its sandboxes used (see
+// /recommendations).  Zero fields mean the defaults.
+type RightsizingConfig struct {
+	// start new sandboxes at the recommended limits, rather than at
+	// limits.mem_mb and limits.cpu_percent
+	Auto_apply bool `json:"auto_apply"`
+	// invocations needed before recommending anything (default 20)
+	Min_samples int `json:"min_samples"`
+	// added to the observed p99 before rounding (default 25)
+	Headroom_percent int `json:"headroom_percent"`
+	// recommendations never go below these (defaults 16 and 10), nor
+	// above limits.mem_mb and limits.cpu_percent
+	Min_mem_mb      int `json:"min_mem_mb"`
+	Min_cpu_percent int `json:"min_cpu_percent"`
+}
+
+// CPUConfig controls how SOCK sandboxes of different lambdas share the
+// worker's CPUs, beyond the hard limits.cpu_percent of each sandbox
+type CPUConfig struct {
+	// put the sandboxes of each lambda in a cgroup of their own, under
+	// the pool root, so the cpu-weight of a lambda (in ol.yaml) is its
+	// share as a whole rather than the share of each of its sandboxes
+	Group_by_lambda bool `json:"group_by_lambda"`
+	// CPUs (e.g., "6-7") only for lambdas with cpu-pinned in ol.yaml;
+	// other sandboxes run on the rest.  Needs group_by_lambda.
+	Pinned_cpus string `json:"pinned_cpus"`
+}
+
+// PriorityConfig controls how interactive and batch invocations (see
+// priority-class in ol.yaml) share the worker.  Zero fields mean the
+// defaults.
+type PriorityConfig struct {
+	// class of lambdas without a priority-class (default "interactive")
+	Default_class string `json:"default_class"`
+	// while sandboxes wait for memory, each lambda gets it in proportion
+	// to the weight of its class (defaults 4 and 1)
+	Interactive_weight int `json:"interactive_weight"`
+	Batch_weight       int `json:"batch_weight"`
+}
+
+// Weight returns the share of a priority class
+func (pc *PriorityConfig) Weight(class string) int {
+	if class == PRIORITY_BATCH {
+		if pc.Batch_weight == 0 {
+			return 1
+		}
+		return pc.Batch_weight
+	}
+	if pc.Interactive_weight == 0 {
+		return 4
+	}
+	return pc.Interactive_weight
+}
+
+// OvercommitConfig lets the SOCK memory pool admit sandboxes by the
+// memory they actually use (memory.current of the sandbox cgroups)
+// rather than by their limits.  Zero fields mean the defaults.
+type OvercommitConfig struct {
+	Enabled bool `json:"enabled"`
+	// the memory limits of all sandboxes may add up to this multiple
+	// of mem_pool_mb (default 2)
+	Ratio float64 `json:"ratio"`
+	// new sandboxes wait while actual usage is above this percent of
+	// mem_pool_mb (default 80)
+	Admit_percent int `json:"admit_percent"`
+	// the evictor starts early when the "some avg10" memory pressure
+	// of the sandbox cgroups exceeds this (default 10)
+	Pressure_avg10 float64 `json:"pressure_avg10"`
+	// how often usage and pressure are sampled (default 500)
+	Sample_ms int `json:"sample_ms"`
+}
+
+// CapacityMB is how much memory a pool of totalMB may hand out (in
+// sandbox memory limits): totalMB, or a multiple of it with overcommit
+func (oc *OvercommitConfig) CapacityMB(totalMB int) int {
+	if !oc.Enabled {
+		return totalMB
+	}
+	ratio := oc.Ratio
+	if ratio == 0 {
+		ratio = 2
+	}
+	return int(float64(totalMB) * ratio)
+}
+
+type SeccompConfig struct {
+	// directory of named profiles: <name>.json files with a list of
+	// allowed syscalls, like {"syscalls": ["read", "write", ...]}
+	Profiles_dir string `json:"profiles_dir"`
+	// profile for sandboxes that don't pick one ("default" is the
+	// allowlist built into the runtime)
+	Default_profile string `json:"default_profile"`
+}
+
+type VolumeConfig struct {
+	// directory on the worker holding the volume's files
+	Path string `json:"path"`
+	// if set, Path is a filesystem of this size, loop-mounted from
+	// <Path>.img (which is created if missing)
+	Size_mb int `json:"size_mb"`
+	// lambdas that may mount the volume read-only ("*" for all)
+	Lambdas []string `json:"lambdas"`
+	// lambdas that may mount the volume read-write ("*" for all)
+	Writers []string `json:"writers"`
+}
+
+// Image looks up a base image by name ("" means the default image)
+func (cfg *Config) Image(name string) (*ImageConfig, error) {
+	if name == "" || name == DEFAULT_IMAGE {
+		return &ImageConfig{
+			SOCK_base_path: cfg.SOCK_base_path,
+			Docker_image:   cfg.Docker.Base_image,
+			Pkgs_dir:       cfg.Pkgs_dir,
+		}, nil
+	}
+
+	img, ok := cfg.Images[name]
+	if !ok {
+		return nil, fmt.Errorf("image '%s' is not configured on this worker", name)
+	}
+	if img.Pkgs_dir == "" && img.SOCK_base_path != "" {
+		img.Pkgs_dir = filepath.Join(img.SOCK_base_path, "packages")
+	}
+	return &img, nil
+}
+
+// Allows reports whether a lambda may mount the volume (read-only, or
+// read-write if readOnly is false)
+func (v *VolumeConfig) Allows(lambdaName string, readOnly bool) bool {
+	lists := [][]string{v.Writers}
+	if readOnly {
+		lists = append(lists, v.Lambdas)
+	}
+	for _, list := range lists {
+		for _, name := range list {
+			if name == "*" || name == lambdaName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type DockerConfig struct {
 	// which OCI implementation to use for the docker sandbox (e.g., runc or runsc)
 	Runtime string `json:"runtime"`
@@ -126,6 +354,9 @@ type StorageConfig struct {
 	Root    StoreString `json:"root"`
 	Scratch StoreString `json:"scratch"`
 	Code    StoreString `json:"code"`
+
+	// size of the tmpfs of each "memory" store (default 64)
+	Memory_mb int `json:"memory_mb"`
 }
 
 // One unified limits struct for both worker defaults and per-lambda overrides.
@@ -146,6 +377,30 @@ type LimitsConfig struct {
 
 	// per-lambda or per-profile runtime cap in seconds.
 	Runtime_sec int `json:"runtime_sec" yaml:"runtime_sec"`
+
+	// how much can a Sandbox write to its scratch dir (/host and
+	// /tmp)?  0 means no limit.  Backed by memory (tmpfs), so it
+	// also counts against Mem_mb.
+	Scratch_mb int `json:"scratch_mb" yaml:"scratch_mb"`
+
+	// how fast can a Sandbox read and write the disk of Worker_dir
+	// (through io.max)?  0 means no limit.
+	Io_read_mbps  int `json:"io_read_mbps" yaml:"io_read_mbps"`
+	Io_write_mbps int `json:"io_write_mbps" yaml:"io_write_mbps"`
+	Io_read_iops  int `json:"io_read_iops" yaml:"io_read_iops"`
+	Io_write_iops int `json:"io_write_iops" yaml:"io_write_iops"`
+}
+
+// HasIOLimits reports whether any of the io_ limits are set
+func (lc *LimitsConfig) HasIOLimits() bool {
+	return lc.Io_read_mbps != 0 || lc.Io_write_mbps != 0 || lc.Io_read_iops != 0 || lc.Io_write_iops != 0
+}
+
+func (lc *LimitsConfig) checkIOLimits() error {
+	if lc.Io_read_mbps < 0 || lc.Io_write_mbps < 0 || lc.Io_read_iops < 0 || lc.Io_write_iops < 0 {
+		return fmt.Errorf("limits.io_ limits cannot be negative")
+	}
+	return nil
 }
 
 // WithDefaults returns a new LimitsConfig where zero fields are filled from def.
@@ -172,6 +427,21 @@ func (lc *LimitsConfig) WithDefaults(def *LimitsConfig) LimitsConfig {
 	if out.Runtime_sec == 0 {
 		out.Runtime_sec = def.Runtime_sec
 	}
+	if out.Scratch_mb == 0 {
+		out.Scratch_mb = def.Scratch_mb
+	}
+	if out.Io_read_mbps == 0 {
+		out.Io_read_mbps = def.Io_read_mbps
+	}
+	if out.Io_write_mbps == 0 {
+		out.Io_write_mbps = def.Io_write_mbps
+	}
+	if out.Io_read_iops == 0 {
+		out.Io_read_iops = def.Io_read_iops
+	}
+	if out.Io_write_iops == 0 {
+		out.Io_write_iops = def.Io_write_iops
+	}
 	return out
 }
 
@@ -230,6 +500,21 @@ func GetDefaultWorkerConfig(olPath string) (*Config, error) {
 					cfg.Import_cache_tree = defaultCfg.Import_cache_tree
 					slog.Info("Patched Import_cache_tree", "Import_cache_tree", cfg.Import_cache_tree)
 				}
+				if cfg.Secrets_key_file == "" {
+					cfg.Secrets_key_file = defaultCfg.Secrets_key_file
+					slog.Info("Patched Secrets_key_file", "Secrets_key_file", cfg.Secrets_key_file)
+				}
+				if cfg.Seccomp.Profiles_dir == "" {
+					cfg.Seccomp.Profiles_dir = defaultCfg.Seccomp.Profiles_dir
+					slog.Info("Patched Seccomp.Profiles_dir", "Profiles_dir", cfg.Seccomp.Profiles_dir)
+				}
+				if cfg.Seccomp.Default_profile == "" {
+					cfg.Seccomp.Default_profile = defaultCfg.Seccomp.Default_profile
+				}
+				if cfg.Network == (NetworkConfig{}) {
+					cfg.Network = defaultCfg.Network
+					slog.Info("Patched Network to defaults")
+				}
 				if cfg.Mem_pool_mb == 0 {
 					cfg.Mem_pool_mb = defaultCfg.Mem_pool_mb
 					slog.Info("Patched Mem_pool_mb", "Mem_pool_mb", cfg.Mem_pool_mb)
@@ -255,7 +540,7 @@ func GetDefaultWorkerConfig(olPath string) (*Config, error) {
 
 // getDefaultConfigForPatching generates the default config used for patching empty template fields
 func getDefaultConfigForPatching(olPath string) (*Config, error) {
-	var workerDir, registryDir, baseImgDir, zygoteTreePath, packagesDir string
+	var workerDir, registryDir, baseImgDir, zygoteTreePath, packagesDir, secretsKeyFile, seccompDir string
 
 	if olPath != "" {
 		workerDir = filepath.Join(olPath, "worker")
@@ -263,6 +548,8 @@ func getDefaultConfigForPatching(olPath string) (*Config, error) {
 		baseImgDir = filepath.Join(olPath, "lambda")
 		zygoteTreePath = filepath.Join(olPath, "default-zygotes-40.json")
 		packagesDir = filepath.Join(baseImgDir, "packages")
+		secretsKeyFile = filepath.Join(olPath, "secrets.key")
+		seccompDir = filepath.Join(olPath, "seccomp-profiles")
 	}
 
 	in := &syscall.Sysinfo_t{}
@@ -306,7 +593,9 @@ func getDefaultConfigForPatching(olPath string) (*Config, error) {
 		Sandbox_config:    map[string]any{},
 		SOCK_base_path:    baseImgDir,
 		Registry_cache_ms: 5000, // 5 seconds
+		Secrets_key_file:  secretsKeyFile,
 		Mem_pool_mb:       memPoolMb,
+		Shutdown_grace_ms: 1000,
 		Import_cache_tree: zygoteTreePath,
 		Docker: DockerConfig{
 			Base_image: "ol-min",
@@ -330,6 +619,14 @@ func getDefaultConfigForPatching(olPath string) (*Config, error) {
 			Scratch: "",
 			Code:    "",
 		},
+		Seccomp: SeccompConfig{
+			Profiles_dir:    seccompDir,
+			Default_profile: "default",
+		},
+		Network: NetworkConfig{
+			Default_mode: NET_HOST,
+			Subnet:       "10.200.0.0/16",
+		},
 		Kafka: KafkaConfig{
 			Cache_enabled:          true,
 			Cache_size:             1024,
@@ -392,15 +689,16 @@ func checkConf(cfg *Config) error {
 		// enough free memory to spin up another container.
 		// So we need at least double a memory's needs,
 		// otherwise anything running will immediately be
-		// evicted.
+		// evicted.  With overcommit, limits only need to fit
+		// in the (larger) capacity.
 		//
 		// TODO: revise evictor and relax this
 		// We check against both the regular user limits and the installer limits.
 		minMem := 2 * Max(cfg.InstallerLimits.Mem_mb, cfg.Limits.Mem_mb)
-		if minMem > cfg.Mem_pool_mb {
+		if minMem > cfg.Mem_overcommit.CapacityMB(cfg.Mem_pool_mb) {
 			return fmt.Errorf(
-				"memPoolMb must be at least %d (current=%d, user_mem_mb=%d, installer_mem_mb=%d)",
-				minMem, cfg.Mem_pool_mb, cfg.Limits.Mem_mb, cfg.InstallerLimits.Mem_mb,
+				"memPoolMb must be at least %d (current=%d, user_mem_mb=%d, installer_mem_mb=%d, overcommit=%v)",
+				minMem, cfg.Mem_pool_mb, cfg.Limits.Mem_mb, cfg.InstallerLimits.Mem_mb, cfg.Mem_overcommit.Enabled,
 			)
 		}
 	} else if cfg.Sandbox == "docker" {
@@ -415,10 +713,160 @@ func checkConf(cfg *Config) error {
 		if cfg.Features.Import_cache != "" {
 			return fmt.Errorf("features.import_cache must be disabled for docker Sandbox")
 		}
+	} else if cfg.Sandbox == "process" {
+		// the runtime (and packages, by default) come from the base
+		if cfg.SOCK_base_path == "" || !path.IsAbs(cfg.SOCK_base_path) {
+			return fmt.Errorf("must specify an absolute sock_base_path for process Sandbox")
+		}
+
+		if cfg.Features.Import_cache != "" {
+			return fmt.Errorf("features.import_cache must be disabled for process Sandbox")
+		}
+
+		// these would need mounts, and so root
+		if cfg.Storage.Scratch != "" || cfg.Storage.Code != "" {
+			return fmt.Errorf("storage.scratch and storage.code must be \"\" for process Sandbox")
+		}
+		if cfg.Limits.Scratch_mb != 0 {
+			return fmt.Errorf("limits.scratch_mb is not supported by process Sandbox")
+		}
 	} else {
 		return fmt.Errorf("Unknown Sandbox type '%s'", cfg.Sandbox)
 	}
 
+	if cfg.Limits.Scratch_mb < 0 {
+		return fmt.Errorf("limits.scratch_mb cannot be negative")
+	}
+	if cfg.Runtime_log_kb < 0 {
+		return fmt.Errorf("runtime_log_kb cannot be negative")
+	}
+	if cfg.Shutdown_grace_ms < 0 {
+		return fmt.Errorf("shutdown_grace_ms cannot be negative")
+	}
+	if err := cfg.Limits.checkIOLimits(); err != nil {
+		return err
+	}
+	if cfg.Limits.HasIOLimits() && cfg.Sandbox != "sock" {
+		return fmt.Errorf("limits.io_ limits only apply to the sock Sandbox")
+	}
+
+	for name, img := range cfg.Images {
+		if !HandlerNameRegex.MatchString(name) || name == DEFAULT_IMAGE {
+			return fmt.Errorf("invalid image name '%s'", name)
+		}
+		if cfg.Sandbox != "docker" && !path.IsAbs(img.SOCK_base_path) {
+			return fmt.Errorf("sock_base_path of image '%s' must be an absolute path", name)
+		}
+		if cfg.Sandbox == "docker" {
+			if img.Docker_image == "" {
+				return fmt.Errorf("must specify docker_image of image '%s'", name)
+			}
+			if !path.IsAbs(img.Pkgs_dir) {
+				return fmt.Errorf("pkgs_dir of image '%s' must be an absolute path", name)
+			}
+		}
+	}
+
+	if oc := cfg.Mem_overcommit; oc.Enabled {
+		if cfg.Sandbox != "sock" {
+			return fmt.Errorf("mem_overcommit only applies to the sock Sandbox")
+		}
+		if oc.Ratio != 0 && oc.Ratio < 1 {
+			return fmt.Errorf("mem_overcommit.ratio must be at least 1")
+		}
+		if oc.Admit_percent < 0 || oc.Admit_percent > 100 {
+			return fmt.Errorf("mem_overcommit.admit_percent must be between 0 and 100")
+		}
+		if oc.Pressure_avg10 < 0 || oc.Pressure_avg10 > 100 {
+			return fmt.Errorf("mem_overcommit.pressure_avg10 must be between 0 and 100")
+		}
+		if oc.Sample_ms < 0 {
+			return fmt.Errorf("mem_overcommit.sample_ms cannot be negative")
+		}
+	}
+
+	if rs := cfg.Rightsizing; rs.Min_samples < 0 || rs.Headroom_percent < 0 || rs.Min_mem_mb < 0 || rs.Min_cpu_percent < 0 {
+		return fmt.Errorf("rightsizing settings cannot be negative")
+	} else if rs.Min_mem_mb > cfg.Limits.Mem_mb || rs.Min_cpu_percent > cfg.Limits.CPU_percent {
+		return fmt.Errorf("rightsizing.min_mem_mb and min_cpu_percent cannot exceed limits.mem_mb and limits.cpu_percent")
+	}
+
+	if cfg.CPU.Group_by_lambda && cfg.Sandbox != "sock" {
+		return fmt.Errorf("cpu.group_by_lambda only applies to the sock Sandbox")
+	}
+	if cfg.CPU.Pinned_cpus != "" {
+		if !cfg.CPU.Group_by_lambda {
+			return fmt.Errorf("cpu.pinned_cpus needs cpu.group_by_lambda")
+		}
+		if cpus, err := ParseCPUList(cfg.CPU.Pinned_cpus); err != nil {
+			return fmt.Errorf("cpu.pinned_cpus: %w", err)
+		} else if len(cpus) == 0 {
+			return fmt.Errorf("cpu.pinned_cpus cannot be empty")
+		}
+	}
+
+	if pc := cfg.Priority; pc.Default_class != "" && !isPriorityClass(pc.Default_class) {
+		return fmt.Errorf("priority.default_class must be '%s' or '%s'", PRIORITY_INTERACTIVE, PRIORITY_BATCH)
+	} else if pc.Interactive_weight < 0 || pc.Batch_weight < 0 {
+		return fmt.Errorf("priority weights cannot be negative")
+	}
+
+	switch cfg.Evictor.Policy {
+	case "", "lru", "lfu", "cost":
+	default:
+		return fmt.Errorf("evictor.policy must be 'lru', 'lfu', or 'cost'")
+	}
+	if cfg.Evictor.Free_percent < 0 || cfg.Evictor.Free_percent > 100 {
+		return fmt.Errorf("evictor.free_percent must be between 0 and 100")
+	}
+	if cfg.Evictor.Concurrent < 0 {
+		return fmt.Errorf("evictor.concurrent cannot be negative")
+	}
+
+	if cfg.Rootless.Enabled {
+		if cfg.Sandbox != "sock" {
+			return fmt.Errorf("rootless.enabled only applies to the sock Sandbox")
+		}
+		root := path.Clean(cfg.Rootless.Cgroup_root)
+		if !strings.HasPrefix(root, "/sys/fs/cgroup/") {
+			return fmt.Errorf("rootless.cgroup_root must be a delegated directory under /sys/fs/cgroup")
+		}
+		// these need a network namespace in /run/netns, or a loop device
+		switch cfg.Network.Default_mode {
+		case "", NET_HOST:
+		default:
+			return fmt.Errorf("network.default_mode must be '%s' for rootless workers", NET_HOST)
+		}
+		for name, vol := range cfg.Volumes {
+			if vol.Size_mb > 0 {
+				return fmt.Errorf("volume '%s' cannot have a size_mb on a rootless worker", name)
+			}
+		}
+	}
+
+	switch cfg.Network.Default_mode {
+	case "", NET_HOST, NET_NONE, NET_LOOPBACK:
+	default:
+		return fmt.Errorf("network.default_mode must be '%s', '%s', or '%s'", NET_HOST, NET_NONE, NET_LOOPBACK)
+	}
+	if cfg.Network.Subnet != "" {
+		if ip, _, err := net.ParseCIDR(cfg.Network.Subnet); err != nil || ip.To4() == nil {
+			return fmt.Errorf("network.subnet must be an IPv4 CIDR (got '%s')", cfg.Network.Subnet)
+		}
+	}
+
+	for name, vol := range cfg.Volumes {
+		if !HandlerNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid volume name '%s'", name)
+		}
+		if !path.IsAbs(vol.Path) {
+			return fmt.Errorf("path of volume '%s' must be absolute", name)
+		}
+		if vol.Size_mb < 0 {
+			return fmt.Errorf("size_mb of volume '%s' cannot be negative", name)
+		}
+	}
+
 	return nil
 }
 
@@ -514,7 +962,12 @@ func GetOlPath(ctx *cli.Context) (string, error) {
 	return filepath.Abs(olPath)
 }
 
-// CgroupPoolPath returns the cgroup pool root path for the given OL directory.
+// CgroupPoolPath returns the cgroup pool root path for the given OL
+// directory.  It is under the delegated subtree for rootless workers.
 func CgroupPoolPath(olPath string) string {
-	return filepath.Join("/sys/fs/cgroup", filepath.Base(olPath)+"-sandboxes")
+	root := "/sys/fs/cgroup"
+	if Conf != nil && Conf.Rootless.Enabled {
+		root = Conf.Rootless.Cgroup_root
+	}
+	return filepath.Join(root, filepath.Base(olPath)+"-sandboxes")
 }
@@ -5,6 +5,7 @@ type RuntimeType int
 const (
 	RT_PYTHON RuntimeType = iota
 	RT_NATIVE             = iota
+	RT_CUSTOM             = iota // command from ol.yaml (see CustomRuntime)
 )
 
 // LambdaFileExtension is the file extension used for lambda packages.
@@ -0,0 +1,25 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("6,0-2, 2-3\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cpus, []int{0, 1, 2, 3, 6}) {
+		t.Errorf("got %v", cpus)
+	}
+	if s := FormatCPUList(cpus); s != "0-3,6" {
+		t.Errorf("formatted as %s", s)
+	}
+
+	for _, bad := range []string{"a", "3-1", "-1", "1-"} {
+		if _, err := ParseCPUList(bad); err == nil {
+			t.Errorf("expected error for '%s'", bad)
+		}
+	}
+}
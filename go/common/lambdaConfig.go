@@ -17,6 +17,13 @@ import (
 
 const LambdaConfigFilename = "ol.yaml"
 
+// A config overlay is a partial LambdaConfig layered over the ol.yaml in a
+// lambda's code, so config can change without re-uploading the code.  The
+// registry stores it under <name>+LambdaConfigOverlayExtension, and workers
+// place it next to the code as LambdaConfigOverlayFilename.
+const LambdaConfigOverlayExtension = ".overlay.yaml"
+const LambdaConfigOverlayFilename = "ol.overlay.yaml"
+
 var HandlerNameRegex = regexp.MustCompile(`^[A-Za-z0-9\.\-\_]+$`)
 
 // Triggers defines different ways a lambda can be invoked
@@ -37,18 +44,109 @@ type CronTrigger struct {
 type KafkaTrigger struct {
 	BootstrapServers []string `yaml:"bootstrap_servers" json:"bootstrap_servers"` // e.g., ["localhost:9092"]
 	Topics           []string `yaml:"topics" json:"topics"`                       // e.g., ["events", "logs"]
-	GroupId          string   `yaml:"-" json:"-"`                                 // Auto-generated based on lambda name
+	GroupId          string   `yaml:"-" json:"-"`                                 // Auto-generated based on lambda name (see KafkaGroupId)
 	AutoOffsetReset  string   `yaml:"auto_offset_reset" json:"auto_offset_reset"` // "earliest" or "latest"
 }
 
+// KafkaGroupId returns the consumer group of a lambda's Kafka triggers
+func KafkaGroupId(lambdaName string) string {
+	return fmt.Sprintf("lambda-%s", lambdaName)
+}
+
+// SeccompPolicy selects the syscall filter for a lambda's sandboxes
+type SeccompPolicy struct {
+	// name of a profile in the worker's seccomp.profiles_dir ("" for the
+	// worker's default profile)
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	// log syscalls the profile would deny (in the kernel log), but let
+	// them through
+	Audit bool `yaml:"audit,omitempty" json:"audit,omitempty"`
+}
+
+// CustomRuntime runs a lambda with a server of its own (e.g., for Node or
+// Java), rather than one of the runtimes built into OpenLambda
+type CustomRuntime struct {
+	// program and arguments of the server, which is started in /handler
+	// and must serve HTTP on the Unix socket /host/ol.sock
+	Command []string `yaml:"command" json:"command"`
+	// how long the server may take to start listening (default 10)
+	ReadyTimeoutSec int `yaml:"ready_timeout_sec,omitempty" json:"ready_timeout_sec,omitempty"`
+}
+
+// VolumeMount requests one of the worker's named volumes (see
+// Config.Volumes) for a lambda's sandboxes
+type VolumeMount struct {
+	Name string `yaml:"name" json:"name"`
+	// where the volume appears in the sandbox (somewhere under /mnt)
+	Mount string `yaml:"mount" json:"mount"`
+	// "ro" (the default) or "rw"
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// ReadOnly reports whether the volume is mounted read-only
+func (m *VolumeMount) ReadOnly() bool {
+	return m.Mode != "rw"
+}
+
 // LambdaConfig defines the overall configuration for the lambda function.
 type LambdaConfig struct {
-	Triggers     Triggers          `yaml:"triggers"`      // List of HTTP triggers
-	Environment  map[string]string `yaml:"environment"`   // Environment variables for the lambda
-	ReuseSandbox bool              `yaml:"reuse-sandbox"` // if true, sandbox is reused across invocations
+	Triggers     Triggers          `yaml:"triggers"`          // List of HTTP triggers
+	Environment  map[string]string `yaml:"environment"`       // Environment variables for the lambda
+	ReuseSandbox bool              `yaml:"reuse-sandbox"`     // if true, sandbox is reused across invocations
+	WritableRoot bool              `yaml:"writable-root"`     // if true, root FS writes go to a per-sandbox overlay
+	Network      *NetworkPolicy    `yaml:"network,omitempty"` // nil means the worker's default
+	Seccomp      *SeccompPolicy    `yaml:"seccomp,omitempty"` // nil means the worker's default
+	Volumes      []VolumeMount     `yaml:"volumes,omitempty"` // worker volumes to mount
+	Limits       *LimitsConfig     `yaml:"limits,omitempty"`  // zero fields mean the worker's limits
+	Image        string            `yaml:"image,omitempty"`   // base image ("" means the worker's default)
+	Runtime      *CustomRuntime    `yaml:"runtime,omitempty"` // nil means detect from f.py or f.bin
+
+	// sandboxes of lambdas with lower priorities are evicted first
+	// under memory pressure (between -100 and 100; default 0)
+	EvictionPriority int `yaml:"eviction-priority,omitempty"`
+	// share of CPU time when the worker is busy, relative to other
+	// lambdas (between 1 and 10000; default 100, as for cpu.weight)
+	CPUWeight int `yaml:"cpu-weight,omitempty"`
+	// if true, run on the worker's cpu.pinned_cpus, away from lambdas
+	// without it
+	CPUPinned bool `yaml:"cpu-pinned,omitempty"`
+	// "interactive" or "batch" ("" means the worker's
+	// priority.default_class); a request's X-OL-Priority header wins
+	PriorityClass string `yaml:"priority-class,omitempty"`
+	// how many requests one sandbox may serve at once (default 1), for
+	// lambdas that can handle them concurrently (e.g., async ones)
+	Concurrency int `yaml:"concurrency,omitempty"`
 	// Additional configurations can be added here.
 }
 
+// priority classes of invocations (see LambdaConfig.PriorityClass)
+const (
+	PRIORITY_INTERACTIVE = "interactive"
+	PRIORITY_BATCH       = "batch"
+)
+
+func isPriorityClass(class string) bool {
+	return class == PRIORITY_INTERACTIVE || class == PRIORITY_BATCH
+}
+
+// Priority returns the class of the lambda's invocations, falling back
+// to the worker's default
+func (config *LambdaConfig) Priority() string {
+	if config.PriorityClass != "" {
+		return config.PriorityClass
+	}
+	if Conf != nil && Conf.Priority.Default_class != "" {
+		return Conf.Priority.Default_class
+	}
+	return PRIORITY_INTERACTIVE
+}
+
+// MaxConcurrency returns how many requests each sandbox of the lambda
+// may serve at once
+func (config *LambdaConfig) MaxConcurrency() int {
+	return Max(config.Concurrency, 1)
+}
+
 // LoadDefaultLambdaConfig initializes the configuration with default values.
 func LoadDefaultLambdaConfig() *LambdaConfig {
 	return &LambdaConfig{
@@ -92,6 +190,93 @@ func checkLambdaConfig(config *LambdaConfig) error {
 		}
 	}
 
+	if config.Network != nil {
+		if err := checkNetworkPolicy(config.Network); err != nil {
+			return err
+		}
+	}
+
+	if config.Seccomp != nil && config.Seccomp.Profile != "" {
+		if !HandlerNameRegex.MatchString(config.Seccomp.Profile) {
+			return fmt.Errorf("invalid seccomp profile name '%s'", config.Seccomp.Profile)
+		}
+	}
+
+	if config.Runtime != nil {
+		if len(config.Runtime.Command) == 0 || config.Runtime.Command[0] == "" {
+			return fmt.Errorf("custom runtime must have a command")
+		}
+		if config.Runtime.ReadyTimeoutSec < 0 {
+			return fmt.Errorf("runtime.ready_timeout_sec cannot be negative")
+		}
+		// the filters are installed by the built-in runtimes
+		if config.Seccomp != nil {
+			return fmt.Errorf("seccomp profiles are not supported with a custom runtime")
+		}
+	}
+
+	if config.Image != "" && !HandlerNameRegex.MatchString(config.Image) {
+		return fmt.Errorf("invalid image name '%s'", config.Image)
+	}
+
+	if config.Limits != nil {
+		// TODO: apply the other limits per lambda too
+		perLambda := LimitsConfig{
+			Scratch_mb:    config.Limits.Scratch_mb,
+			Io_read_mbps:  config.Limits.Io_read_mbps,
+			Io_write_mbps: config.Limits.Io_write_mbps,
+			Io_read_iops:  config.Limits.Io_read_iops,
+			Io_write_iops: config.Limits.Io_write_iops,
+		}
+		if *config.Limits != perLambda {
+			return fmt.Errorf("only scratch_mb and the io_ limits can be set in the limits of a lambda")
+		}
+		if config.Limits.Scratch_mb < 0 {
+			return fmt.Errorf("limits.scratch_mb cannot be negative")
+		}
+		if err := config.Limits.checkIOLimits(); err != nil {
+			return err
+		}
+	}
+
+	if config.EvictionPriority < -100 || config.EvictionPriority > 100 {
+		return fmt.Errorf("eviction-priority must be between -100 and 100")
+	}
+	if config.CPUWeight < 0 || config.CPUWeight > 10000 {
+		return fmt.Errorf("cpu-weight must be between 1 and 10000")
+	}
+	if config.Concurrency < 0 || config.Concurrency > 1000 {
+		return fmt.Errorf("concurrency must be between 1 and 1000")
+	}
+	if config.Concurrency > 1 && !config.ReuseSandbox {
+		return fmt.Errorf("concurrency needs reuse-sandbox, as sandboxes are destroyed after each request without it")
+	}
+	if config.PriorityClass != "" && !isPriorityClass(config.PriorityClass) {
+		return fmt.Errorf("priority-class must be '%s' or '%s'", PRIORITY_INTERACTIVE, PRIORITY_BATCH)
+	}
+
+	mounts := make(map[string]bool)
+	for _, vol := range config.Volumes {
+		if !HandlerNameRegex.MatchString(vol.Name) {
+			return fmt.Errorf("invalid volume name '%s'", vol.Name)
+		}
+		if vol.Mode != "" && vol.Mode != "ro" && vol.Mode != "rw" {
+			return fmt.Errorf("volume '%s' has mode '%s' (expected 'ro' or 'rw')", vol.Name, vol.Mode)
+		}
+		// the base image is read-only, so mount points can't be
+		// created just anywhere (a tmpfs is placed over /mnt for them)
+		mount := filepath.Clean(vol.Mount)
+		if mount != vol.Mount || !strings.HasPrefix(mount, "/mnt/") {
+			return fmt.Errorf("volume '%s' must be mounted at a clean path under /mnt/ (got '%s')", vol.Name, vol.Mount)
+		}
+		for other := range mounts {
+			if mount == other || strings.HasPrefix(mount, other+"/") || strings.HasPrefix(other, mount+"/") {
+				return fmt.Errorf("volume mount points '%s' and '%s' overlap", other, mount)
+			}
+		}
+		mounts[mount] = true
+	}
+
 	// Validate environment variables
 	for key, value := range config.Environment {
 		if key == "" {
@@ -110,7 +295,12 @@ func checkLambdaConfig(config *LambdaConfig) error {
 
 // ParseYaml reads and parses the YAML configuration file.
 func LoadLambdaConfig(codeDir string) (*LambdaConfig, error) {
-	path := filepath.Join(codeDir, LambdaConfigFilename)
+	return LoadLambdaConfigFile(filepath.Join(codeDir, LambdaConfigFilename))
+}
+
+// LoadLambdaConfigFile is like LoadLambdaConfig, for a config file that
+// may not be named ol.yaml (e.g., an override in a stack file)
+func LoadLambdaConfigFile(path string) (*LambdaConfig, error) {
 	file, err := os.Open(path)
 
 	if errors.Is(err, os.ErrNotExist) {
@@ -133,6 +323,105 @@ func LoadLambdaConfig(codeDir string) (*LambdaConfig, error) {
 	return config, checkLambdaConfig(config)
 }
 
+// LoadLambdaConfigWithOverlay is like LoadLambdaConfig, but also applies
+// the config overlay in codeDir, if any.
+func LoadLambdaConfigWithOverlay(codeDir string) (*LambdaConfig, error) {
+	config, err := LoadLambdaConfig(codeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(codeDir, LambdaConfigOverlayFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config overlay: %v", err)
+	}
+
+	overlay, err := ParseLambdaConfigOverlay(data)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyLambdaConfigOverlay(config, overlay)
+}
+
+// ParseLambdaConfigOverlay parses a partial LambdaConfig, in YAML or JSON
+// (which is also YAML), into a generic map.
+func ParseLambdaConfigOverlay(data []byte) (map[string]any, error) {
+	overlay := make(map[string]any)
+	if err := yaml.Unmarshal(data, &overlay); err != nil {
+		return nil, fmt.Errorf("failed to parse config overlay: %v", err)
+	}
+	return overlay, nil
+}
+
+// MergeLambdaConfigOverlays layers patch over overlay, returning a new map.
+// Nested maps (e.g., environment) are merged key by key; anything else,
+// including lists such as triggers, is replaced.  A null in patch is kept,
+// so that it still removes the key from the base config later.
+func MergeLambdaConfigOverlays(overlay map[string]any, patch map[string]any) map[string]any {
+	return mergeConfigMaps(overlay, patch, true)
+}
+
+// ApplyLambdaConfigOverlay returns a copy of base with the overlay merged
+// in (with the same rules as MergeLambdaConfigOverlays, except that null
+// values delete keys).  Unknown fields and invalid results are errors.
+func ApplyLambdaConfigOverlay(base *LambdaConfig, overlay map[string]any) (*LambdaConfig, error) {
+	data, err := yaml.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	baseMap := make(map[string]any)
+	if err := yaml.Unmarshal(data, &baseMap); err != nil {
+		return nil, err
+	}
+
+	merged, err := yaml.Marshal(mergeConfigMaps(baseMap, overlay, false))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &LambdaConfig{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(merged)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid config overlay: %v", err)
+	}
+
+	if err := checkLambdaConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid config overlay: %v", err)
+	}
+	return config, nil
+}
+
+func mergeConfigMaps(dst map[string]any, src map[string]any, keepNull bool) map[string]any {
+	result := make(map[string]any, len(dst)+len(src))
+	for k, v := range dst {
+		result[k] = v
+	}
+
+	for k, v := range src {
+		if v == nil && !keepNull {
+			delete(result, k)
+			continue
+		}
+
+		srcMap, srcIsMap := v.(map[string]any)
+		dstMap, dstIsMap := result[k].(map[string]any)
+		if srcIsMap && dstIsMap {
+			result[k] = mergeConfigMaps(dstMap, srcMap, keepNull)
+		} else if srcIsMap && !keepNull {
+			// drop nulls nested inside maps that have nothing to merge with
+			result[k] = mergeConfigMaps(map[string]any{}, srcMap, false)
+		} else {
+			result[k] = v
+		}
+	}
+
+	return result
+}
+
 func ExtractConfigFromTarGz(tarPath string) (*LambdaConfig, error) {
 	f, err := os.Open(tarPath)
 	if err != nil {
@@ -150,3 +150,102 @@ func TestExtractConfigFromTarGz_RootLevel(t *testing.T) {
 		})
 	}
 }
+
+// TestApplyLambdaConfigOverlay verifies that overlays merge maps key by
+// key, replace lists, delete keys set to null, and reject bad configs.
+func TestApplyLambdaConfigOverlay(t *testing.T) {
+	base := LoadDefaultLambdaConfig()
+	base.Environment["KEEP"] = "1"
+	base.Environment["DROP"] = "2"
+
+	first, err := ParseLambdaConfigOverlay([]byte(`{"environment": {"LEVEL": "debug", "DROP": null}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ParseLambdaConfigOverlay([]byte("triggers:\n  cron:\n    - schedule: \"*/5 * * * *\"\nreuse-sandbox: false\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ApplyLambdaConfigOverlay(base, MergeLambdaConfigOverlays(first, second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if config.Environment["KEEP"] != "1" || config.Environment["LEVEL"] != "debug" {
+		t.Errorf("environment not merged: %v", config.Environment)
+	}
+	if _, ok := config.Environment["DROP"]; ok {
+		t.Errorf("expected DROP to be removed: %v", config.Environment)
+	}
+	if len(config.Triggers.Cron) != 1 || len(config.Triggers.HTTP) != 1 {
+		t.Errorf("unexpected triggers: %+v", config.Triggers)
+	}
+	if config.ReuseSandbox {
+		t.Errorf("expected ReuseSandbox=false")
+	}
+	if base.Environment["DROP"] != "2" {
+		t.Errorf("base config was modified")
+	}
+
+	for _, bad := range []string{
+		`{"enviroment": {"A": "1"}}`,
+		`{"triggers": {"cron": [{"schedule": ""}]}}`,
+		`{"limits": {"mem_mb": 100}}`,
+		`{"runtime": {"command": []}}`,
+		`{"eviction-priority": 1000}`,
+		`{"cpu-weight": 20000}`,
+		`{"limits": {"io_write_mbps": -1}}`,
+		`{"priority-class": "urgent"}`,
+		`{"concurrency": -1}`,
+		`{"reuse-sandbox": false, "concurrency": 4}`,
+	} {
+		overlay, err := ParseLambdaConfigOverlay([]byte(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyLambdaConfigOverlay(base, overlay); err == nil {
+			t.Errorf("expected error for overlay %s", bad)
+		}
+	}
+}
+
+// TestVolumes verifies volume mount validation and the worker's allowlists.
+func TestVolumes(t *testing.T) {
+	tests := []struct {
+		name  string
+		mount VolumeMount
+		valid bool
+	}{
+		{"read-only by default", VolumeMount{Name: "models", Mount: "/mnt/models"}, true},
+		{"read-write", VolumeMount{Name: "state", Mount: "/mnt/state", Mode: "rw"}, true},
+		{"outside /mnt", VolumeMount{Name: "models", Mount: "/usr/models"}, false},
+		{"unclean path", VolumeMount{Name: "models", Mount: "/mnt/../etc"}, false},
+		{"bad mode", VolumeMount{Name: "models", Mount: "/mnt/models", Mode: "wo"}, false},
+		{"bad name", VolumeMount{Name: "../models", Mount: "/mnt/models"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := LoadDefaultLambdaConfig()
+			config.Volumes = []VolumeMount{tt.mount}
+			err := checkLambdaConfig(config)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !tt.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+
+	config := LoadDefaultLambdaConfig()
+	config.Volumes = []VolumeMount{{Name: "a", Mount: "/mnt/data"}, {Name: "b", Mount: "/mnt/data/b"}}
+	if err := checkLambdaConfig(config); err == nil {
+		t.Errorf("expected an error for overlapping mount points")
+	}
+
+	vol := VolumeConfig{Path: "/data/models", Lambdas: []string{"*"}, Writers: []string{"trainer"}}
+	if !vol.Allows("infer", true) || vol.Allows("infer", false) || !vol.Allows("trainer", false) {
+		t.Errorf("unexpected result from Allows")
+	}
+}
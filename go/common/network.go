@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// network modes for sandboxes (see NetworkPolicy)
+const (
+	NET_HOST     = "host"
+	NET_NONE     = "none"
+	NET_LOOPBACK = "loopback"
+	NET_EGRESS   = "egress"
+)
+
+var dnsNameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9\-\.]*[A-Za-z0-9])?$`)
+
+// NetworkPolicy controls what a lambda's sandboxes can reach.  Every mode
+// other than "host" gives each sandbox its own network namespace, from
+// which the worker itself (registry, admin endpoints, etc.) is unreachable.
+type NetworkPolicy struct {
+	// "host" shares the worker's network, "none" has no usable
+	// interfaces, "loopback" has only 127.0.0.1, and "egress" can
+	// additionally open connections to the destinations in Allow
+	Mode string `yaml:"mode" json:"mode"`
+
+	// entries of the form <host>[:<port>], where <host> is an IPv4
+	// address, an IPv4 CIDR, or a DNS name (resolved when a sandbox
+	// starts).  Without a port, all ports are allowed.
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty"`
+}
+
+// EgressRule is one parsed entry of NetworkPolicy.Allow
+type EgressRule struct {
+	Host string
+	Port int // 0 means any port
+}
+
+// Isolated reports whether sandboxes get their own network namespace
+// (a nil policy means host networking)
+func (p *NetworkPolicy) Isolated() bool {
+	return p != nil && p.Mode != "" && p.Mode != NET_HOST
+}
+
+func (p *NetworkPolicy) String() string {
+	if !p.Isolated() {
+		return NET_HOST
+	}
+	if len(p.Allow) == 0 {
+		return p.Mode
+	}
+	return fmt.Sprintf("%s[%s]", p.Mode, strings.Join(p.Allow, ","))
+}
+
+func checkNetworkPolicy(p *NetworkPolicy) error {
+	switch p.Mode {
+	case NET_HOST, NET_NONE, NET_LOOPBACK:
+		if len(p.Allow) > 0 {
+			return fmt.Errorf("network allow list requires mode '%s' (got '%s')", NET_EGRESS, p.Mode)
+		}
+	case NET_EGRESS:
+		if len(p.Allow) == 0 {
+			return fmt.Errorf("network mode '%s' requires an allow list", NET_EGRESS)
+		}
+		for _, entry := range p.Allow {
+			if _, err := ParseEgressRule(entry); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown network mode '%s' (expected %s, %s, %s, or %s)",
+			p.Mode, NET_HOST, NET_NONE, NET_LOOPBACK, NET_EGRESS)
+	}
+	return nil
+}
+
+func ParseEgressRule(entry string) (EgressRule, error) {
+	rule := EgressRule{Host: entry}
+
+	if i := strings.LastIndex(entry, ":"); i >= 0 {
+		port, err := strconv.Atoi(entry[i+1:])
+		if err != nil || port < 1 || port > 65535 {
+			return rule, fmt.Errorf("invalid port in network allow entry '%s'", entry)
+		}
+		rule.Host, rule.Port = entry[:i], port
+	}
+
+	// iptables rules are IPv4 only
+	if strings.Contains(rule.Host, "/") {
+		ip, _, err := net.ParseCIDR(rule.Host)
+		if err != nil || ip.To4() == nil {
+			return rule, fmt.Errorf("invalid IPv4 CIDR in network allow entry '%s'", entry)
+		}
+	} else if ip := net.ParseIP(rule.Host); ip != nil {
+		if ip.To4() == nil {
+			return rule, fmt.Errorf("network allow entry '%s' is not IPv4", entry)
+		}
+	} else if !dnsNameRegex.MatchString(rule.Host) {
+		return rule, fmt.Errorf("invalid host in network allow entry '%s'", entry)
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestCheckNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy NetworkPolicy
+		valid  bool
+	}{
+		{"loopback", NetworkPolicy{Mode: NET_LOOPBACK}, true},
+		{"egress with ports and CIDRs", NetworkPolicy{Mode: NET_EGRESS, Allow: []string{"10.0.0.0/8", "api.example.com:443", "1.2.3.4:53"}}, true},
+		{"egress CIDR with port", NetworkPolicy{Mode: NET_EGRESS, Allow: []string{"10.1.0.0/16:5432"}}, true},
+		{"egress needs allow list", NetworkPolicy{Mode: NET_EGRESS}, false},
+		{"allow list needs egress", NetworkPolicy{Mode: NET_NONE, Allow: []string{"10.0.0.1"}}, false},
+		{"unknown mode", NetworkPolicy{Mode: "bridge"}, false},
+		{"bad port", NetworkPolicy{Mode: NET_EGRESS, Allow: []string{"example.com:http"}}, false},
+		{"IPv6", NetworkPolicy{Mode: NET_EGRESS, Allow: []string{"::1"}}, false},
+		{"bad host", NetworkPolicy{Mode: NET_EGRESS, Allow: []string{"exa mple.com"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNetworkPolicy(&tt.policy)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !tt.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+
+	rule, err := ParseEgressRule("10.1.0.0/16:5432")
+	if err != nil || rule.Host != "10.1.0.0/16" || rule.Port != 5432 {
+		t.Errorf("unexpected rule %+v (err=%v)", rule, err)
+	}
+
+	var nilPolicy *NetworkPolicy
+	if nilPolicy.Isolated() || (&NetworkPolicy{Mode: NET_HOST}).Isolated() || !(&NetworkPolicy{Mode: NET_NONE}).Isolated() {
+		t.Errorf("unexpected result from Isolated")
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Secrets are stored in the registry under SecretKeyPrefix+<name>,
+// encrypted with AES-256-GCM using a master key that never leaves the
+// machine (workers sharing a registry with a boss need a copy of the
+// boss's key file).
+const SecretKeyPrefix = "secrets/"
+
+// lambda environment values may reference secrets as ${secret:<name>}
+var SecretRefRegex = regexp.MustCompile(`\$\{secret:([A-Za-z0-9\.\-\_]+)\}`)
+
+// shown instead of environment values that reference secrets
+const RedactedValue = "[REDACTED]"
+
+const secretKeySize = 32
+
+func ValidateSecretName(name string) error {
+	if !HandlerNameRegex.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf(`invalid secret name %q; must match %s`, name, HandlerNameRegex.String())
+	}
+	return nil
+}
+
+// LoadSecretKey reads the master key at path, generating a new random key
+// there first if the file does not exist yet.
+func LoadSecretKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, secretKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+
+		// O_EXCL: if somebody else (e.g., the boss and a local
+		// worker) created the key concurrently, use theirs
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			return LoadSecretKey(path)
+		} else if err != nil {
+			return nil, fmt.Errorf("could not create secret key %s: %w", path, err)
+		}
+		defer file.Close()
+
+		if _, err := file.Write(key); err != nil {
+			return nil, fmt.Errorf("could not write secret key %s: %w", path, err)
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read secret key %s: %w", path, err)
+	}
+
+	if len(key) != secretKeySize {
+		return nil, fmt.Errorf("secret key %s must be %d bytes, got %d", path, secretKeySize, len(key))
+	}
+	return key, nil
+}
+
+// EncryptSecret returns nonce+ciphertext.  The secret's name is
+// authenticated too, so a stored secret cannot be swapped for another.
+func EncryptSecret(key []byte, name string, plaintext []byte) ([]byte, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+func DecryptSecret(key []byte, name string, data []byte) ([]byte, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secret %s is corrupt", name)
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt secret %s (wrong key?): %w", name, err)
+	}
+	return plaintext, nil
+}
+
+func newSecretGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SplitSecretEnv separates environment variables that reference secrets
+// from those that can be written out as-is.
+func SplitSecretEnv(env map[string]string) (plain map[string]string, secret map[string]string) {
+	plain = make(map[string]string)
+	secret = make(map[string]string)
+	for key, value := range env {
+		if SecretRefRegex.MatchString(value) {
+			secret[key] = value
+		} else {
+			plain[key] = value
+		}
+	}
+	return plain, secret
+}
+
+// ResolveSecretRefs replaces every ${secret:<name>} in value with
+// lookup(name).
+func ResolveSecretRefs(value string, lookup func(name string) (string, error)) (string, error) {
+	var lookupErr error
+	resolved := SecretRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := SecretRefRegex.FindStringSubmatch(ref)[1]
+		secret, err := lookup(name)
+		if err != nil && lookupErr == nil {
+			lookupErr = err
+		}
+		return secret
+	})
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+	return resolved, nil
+}
+
+// Redacted returns a copy of the config that is safe to show to clients,
+// with environment values that reference secrets hidden.
+func (config *LambdaConfig) Redacted() *LambdaConfig {
+	redacted := *config
+	redacted.Environment = make(map[string]string, len(config.Environment))
+	for key, value := range config.Environment {
+		if SecretRefRegex.MatchString(value) {
+			value = RedactedValue
+		}
+		redacted.Environment[key] = value
+	}
+	return &redacted
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "secrets.key")
+	key, err := LoadSecretKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := LoadSecretKey(keyPath); err != nil || string(again) != string(key) {
+		t.Fatalf("expected the key to be reused, got err=%v", err)
+	}
+
+	data, err := EncryptSecret(key, "db-pass", []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := DecryptSecret(key, "db-pass", data); err != nil || string(value) != "hunter2" {
+		t.Errorf("expected hunter2, got %q (err=%v)", value, err)
+	}
+	if _, err := DecryptSecret(key, "other", data); err == nil {
+		t.Errorf("expected a secret stored under another name to be rejected")
+	}
+}
+
+func TestResolveSecretRefs(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "missing" {
+			return "", fmt.Errorf("secret %s not found", name)
+		}
+		return "<" + name + ">", nil
+	}
+
+	value, err := ResolveSecretRefs("postgres://app:${secret:db-pass}@db/${secret:db.name}", lookup)
+	if err != nil || value != "postgres://app:<db-pass>@db/<db.name>" {
+		t.Errorf("unexpected resolution %q (err=%v)", value, err)
+	}
+	if _, err := ResolveSecretRefs("${secret:missing}", lookup); err == nil {
+		t.Errorf("expected an error for a missing secret")
+	}
+
+	config := &LambdaConfig{Environment: map[string]string{"DB_PASS": "${secret:db-pass}", "MODE": "prod"}}
+	redacted := config.Redacted()
+	if redacted.Environment["DB_PASS"] != RedactedValue || redacted.Environment["MODE"] != "prod" {
+		t.Errorf("unexpected redaction %v", redacted.Environment)
+	}
+	if config.Environment["DB_PASS"] != "${secret:db-pass}" {
+		t.Errorf("Redacted modified the original config")
+	}
+}
@@ -44,6 +44,15 @@ type msLatencyMsg struct {
 	x    int64
 }
 
+type countMsg struct {
+	name string
+}
+
+type sumMsg struct {
+	name string
+	x    int64
+}
+
 type snapshotMsg struct {
 	stats map[string]int64
 	done  chan bool
@@ -61,17 +70,29 @@ func initTaskOnce() {
 func statsTask() {
 	msCounts := make(map[string]int64)
 	msSums := make(map[string]int64)
+	counts := make(map[string]int64)
+	sums := make(map[string]int64)
 
 	for raw := range statsChan {
 		switch msg := raw.(type) {
 		case *msLatencyMsg:
 			msCounts[msg.name] += 1
 			msSums[msg.name] += msg.x
+		case *countMsg:
+			counts[msg.name] += 1
+		case *sumMsg:
+			sums[msg.name] += msg.x
 		case *snapshotMsg:
 			for k, cnt := range msCounts {
 				msg.stats[k+".cnt"] = cnt
 				msg.stats[k+".ms-avg"] = msSums[k] / cnt
 			}
+			for k, cnt := range counts {
+				msg.stats[k+".cnt"] = cnt
+			}
+			for k, sum := range sums {
+				msg.stats[k+".sum"] = sum
+			}
 			msg.done <- true
 		default:
 			panic(fmt.Sprintf("unkown type: %T", msg))
@@ -84,6 +105,20 @@ func record(name string, x int64) {
 	statsChan <- &msLatencyMsg{name, x}
 }
 
+// Count records an event (without a latency), which SnapshotStats
+// reports as <name>.cnt
+func Count(name string) {
+	initTaskOnce()
+	statsChan <- &countMsg{name}
+}
+
+// Sum adds x to a total (e.g., of bytes), which SnapshotStats reports
+// as <name>.sum
+func Sum(name string, x int64) {
+	initTaskOnce()
+	statsChan <- &sumMsg{name, x}
+}
+
 func SnapshotStats() map[string]int64 {
 	initTaskOnce()
 	stats := make(map[string]int64)
@@ -41,8 +41,11 @@ func NewDirMaker(system string, mode StoreMode) (*DirMaker, error) {
 	}
 
 	if mode == STORE_MEMORY {
-		// TODO: configure mem size?
-		if err := syscall.Mount("none", prefix, "tmpfs", 0, "size=64m"); err != nil {
+		sizeMB := Conf.Storage.Memory_mb
+		if sizeMB == 0 {
+			sizeMB = 64
+		}
+		if err := syscall.Mount("none", prefix, "tmpfs", 0, fmt.Sprintf("size=%dm", sizeMB)); err != nil {
 			return nil, err
 		}
 	} else if mode == STORE_PRIVATE {
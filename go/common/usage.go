@@ -0,0 +1,96 @@
+package common
+
+import (
+	"sort"
+	"time"
+)
+
+// UsageRecord is what one lambda used in one hour, on one worker (see
+// /usage on the worker) or summed across workers (/usage on the boss).
+type UsageRecord struct {
+	Lambda string `json:"lambda"`
+	// start of the hour, in UTC
+	Hour time.Time `json:"hour"`
+
+	Invocations int64 `json:"invocations"`
+	// invocations from Sandboxes that can't measure usage (e.g.,
+	// docker), which contribute nothing to the fields below
+	Unmetered int64 `json:"unmetered"`
+
+	CPUUsec int64 `json:"cpu_usec"`
+	// sum over invocations of peak memory times execution time
+	MemMBMs int64 `json:"mem_mb_ms"`
+	// largest peak of any one invocation
+	MaxMemPeakMB int `json:"max_mem_peak_mb"`
+}
+
+// Add adds the usage of other (for the same lambda and hour) to r
+func (r *UsageRecord) Add(other *UsageRecord) {
+	r.Invocations += other.Invocations
+	r.Unmetered += other.Unmetered
+	r.CPUUsec += other.CPUUsec
+	r.MemMBMs += other.MemMBMs
+	r.MaxMemPeakMB = Max(r.MaxMemPeakMB, other.MaxMemPeakMB)
+}
+
+// SumUsage combines records of the same lambda and hour, sorted by
+// lambda, then hour
+func SumUsage(records []UsageRecord) []UsageRecord {
+	type key struct {
+		lambda string
+		hour   time.Time
+	}
+
+	sums := make(map[key]*UsageRecord)
+	for i := range records {
+		k := key{records[i].Lambda, records[i].Hour.UTC()}
+		if sum, ok := sums[k]; ok {
+			sum.Add(&records[i])
+		} else {
+			sum := records[i]
+			sum.Hour = k.hour
+			sums[k] = &sum
+		}
+	}
+
+	result := make([]UsageRecord, 0, len(sums))
+	for _, sum := range sums {
+		result = append(result, *sum)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Lambda != result[j].Lambda {
+			return result[i].Lambda < result[j].Lambda
+		}
+		return result[i].Hour.Before(result[j].Hour)
+	})
+	return result
+}
+
+// Percentiles summarizes samples of a lambda's usage
+type Percentiles struct {
+	P50 int `json:"p50"`
+	P95 int `json:"p95"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+}
+
+// Recommendation suggests limits for a lambda from its recent
+// invocations on a worker (see /recommendations)
+type Recommendation struct {
+	Lambda  string `json:"lambda"`
+	Samples int    `json:"samples"`
+
+	// peak memory, and CPU used as a percent of one core over the
+	// invocation's execution time
+	MemPeakMB      Percentiles `json:"mem_peak_mb"`
+	CPUUsedPercent Percentiles `json:"cpu_used_percent"`
+
+	// the recommended limits (0 if there are too few samples)
+	Mem_mb      int `json:"mem_mb"`
+	CPU_percent int `json:"cpu_percent"`
+
+	// whether new sandboxes start at the recommended limits
+	Applied bool `json:"applied"`
+	// why there is no recommendation, or why it isn't applied
+	Note string `json:"note,omitempty"`
+}
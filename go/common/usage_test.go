@@ -0,0 +1,29 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSumUsage(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	records := []UsageRecord{
+		{Lambda: "b", Hour: hour, Invocations: 1, CPUUsec: 10, MemMBMs: 100, MaxMemPeakMB: 20},
+		{Lambda: "a", Hour: hour.Add(time.Hour), Invocations: 2, CPUUsec: 5},
+		{Lambda: "b", Hour: hour.In(time.FixedZone("CDT", -5*3600)), Invocations: 3, Unmetered: 1, CPUUsec: 20, MemMBMs: 50, MaxMemPeakMB: 30},
+		{Lambda: "a", Hour: hour, Invocations: 1},
+	}
+
+	sums := SumUsage(records)
+	if len(sums) != 3 {
+		t.Fatalf("expected 3 records, got %+v", sums)
+	}
+	if sums[0].Lambda != "a" || !sums[0].Hour.Equal(hour) || sums[1].Lambda != "a" || sums[2].Lambda != "b" {
+		t.Errorf("records out of order: %+v", sums)
+	}
+
+	b := sums[2]
+	if b.Invocations != 4 || b.Unmetered != 1 || b.CPUUsec != 30 || b.MemMBMs != 150 || b.MaxMemPeakMB != 30 {
+		t.Errorf("bad sum for b: %+v", b)
+	}
+}
@@ -115,6 +115,11 @@ func upCmd(ctx *cli.Context) error {
 	// should we run as a background process?
 	detach := ctx.Bool("detach")
 
+	// rootless workers run in their own user namespace (see rootless.go)
+	if !detach && needsRootlessReexec() {
+		return runRootless()
+	}
+
 	if detach {
 		// stdout+stderr both go to log
 		logPath := filepath.Join(olPath, "worker.out")
@@ -130,9 +135,15 @@ func upCmd(ctx *cli.Context) error {
 		// mount point, which is a major overhead.
 		attr := os.ProcAttr{
 			Files: []*os.File{nil, f, f},
-			Sys: &syscall.SysProcAttr{
-				Unshareflags: syscall.CLONE_NEWNS,
-			},
+			Sys:   &syscall.SysProcAttr{},
+		}
+		// the process sandbox creates no mount points, and may run
+		// without the privileges to unshare.  Rootless workers get
+		// a mount namespace along with their user namespace.
+		if needsRootlessReexec() {
+			attr.Sys = rootlessSysProcAttr()
+		} else if common.Conf.Sandbox != "process" {
+			attr.Sys.Unshareflags = syscall.CLONE_NEWNS
 		}
 		cmd := []string{}
 		for _, arg := range os.Args {
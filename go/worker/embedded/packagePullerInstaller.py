@@ -63,19 +63,24 @@ def deps(dirname):
     return list(rv)
 
 
+# the process sandbox doesn't chroot, so it tells us where /host is
+HOST_DIR = os.environ.get('OL_HOST_DIR', '/host')
+FILES_DIR = os.path.join(HOST_DIR, 'files')
+
+
 def f(event):
     pkg = event["pkg"]
     alreadyInstalled = event["alreadyInstalled"]
     if not alreadyInstalled:
         try:
             subprocess.check_output(
-                ['pip3', 'install', '--no-deps', pkg, '--cache-dir', '/tmp/.cache', '-t', '/host/files'],
+                ['pip3', 'install', '--no-deps', pkg, '--cache-dir', '/tmp/.cache', '-t', FILES_DIR],
                 stderr=subprocess.STDOUT)
         except subprocess.CalledProcessError as e:
             output = e.output.decode('utf-8') if e.output else ''
             raise Exception(f'pip install failed for {pkg} (exit code {e.returncode}): {output}') from None
 
     name = pkg.split("==")[0]
-    d = deps("/host/files")
-    t = top("/host/files")
+    d = deps(FILES_DIR)
+    t = top(FILES_DIR)
     return {"Deps": d, "TopLevel": t}
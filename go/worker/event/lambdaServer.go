@@ -1,6 +1,7 @@
 package event
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -64,11 +65,81 @@ func (s *LambdaServer) RunLambda(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Invalidate expects requests like this:
+//
+// curl -X POST localhost:8080/invalidate/<lambda-name>
+// curl -X DELETE localhost:8080/invalidate/<lambda-name>
+//
+// POST means the lambda's code changed: the cached copy is dropped and
+// instances are restarted on the latest code.  DELETE means the lambda
+// was removed from the registry, so its instances are torn down.
+func (s *LambdaServer) Invalidate(w http.ResponseWriter, r *http.Request) {
+	lambdaName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, INVALIDATE_PATH), "/")
+	if err := common.ValidateFunctionName(lambdaName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.onRegistryChange(lambdaName, false)
+	case "DELETE":
+		s.onRegistryChange(lambdaName, true)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Lambda %s invalidated\n", lambdaName)
+}
+
+// onRegistryChange applies a registry update to the lambdas running here.
+func (s *LambdaServer) onRegistryChange(lambdaName string, deleted bool) {
+	if deleted {
+		s.lambdaMgr.Remove(lambdaName)
+	} else {
+		s.lambdaMgr.Invalidate(lambdaName)
+	}
+}
+
 // Debug returns the debug information of the lambda manager.
 func (s *LambdaServer) Debug(w http.ResponseWriter, _ *http.Request) {
 	w.Write([]byte(s.lambdaMgr.Debug()))
 }
 
+// Usage returns what each lambda used on this worker, per hour.
+func (s *LambdaServer) Usage(w http.ResponseWriter, _ *http.Request) {
+	b, err := json.MarshalIndent(s.lambdaMgr.Usage.Snapshot(), "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Recommendations returns the limits suggested for each lambda (or just
+// the one named by ?lambda=).
+func (s *LambdaServer) Recommendations(w http.ResponseWriter, r *http.Request) {
+	recs := s.lambdaMgr.Rightsizer.RecommendAll()
+	if lambdaName := r.URL.Query().Get("lambda"); lambdaName != "" {
+		if err := common.ValidateFunctionName(lambdaName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recs = []common.Recommendation{s.lambdaMgr.Rightsizer.Recommend(lambdaName)}
+	}
+
+	b, err := json.MarshalIndent(recs, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
 // cleanup cleans up the lambda manager.
 func (s *LambdaServer) cleanup() {
 	s.lambdaMgr.Cleanup()
@@ -91,6 +162,9 @@ func NewLambdaServer(mux *http.ServeMux) (*LambdaServer, error) {
 	port := fmt.Sprintf(":%s", common.Conf.Worker_port)
 	mux.HandleFunc(RUN_PATH, server.RunLambda)
 	mux.HandleFunc(DEBUG_PATH, server.Debug)
+	mux.HandleFunc(INVALIDATE_PATH, server.Invalidate)
+	mux.HandleFunc(USAGE_PATH, server.Usage)
+	mux.HandleFunc(RECOMMENDATIONS_PATH, server.Recommendations)
 
 	slog.Info(fmt.Sprintf("Execute handler by POSTing to localhost%s%s%s", port, RUN_PATH, "<lambda>"))
 	slog.Info(fmt.Sprintf("Get status by sending request to localhost%s%s", port, STATUS_PATH))
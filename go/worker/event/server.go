@@ -33,13 +33,32 @@ const (
 	PPROF_CPU_START_PATH = "/pprof/cpu-start"
 	PPROF_CPU_STOP_PATH  = "/pprof/cpu-stop"
 
+	// GET /usage: per-lambda, per-hour resource usage (JSON list of
+	// common.UsageRecord)
+	USAGE_PATH = "/usage"
+
+	// GET /recommendations[?lambda=<name>]: memory and CPU limits
+	// suggested by each lambda's usage (JSON list of
+	// common.Recommendation)
+	RECOMMENDATIONS_PATH = "/recommendations"
+
+	// POST /invalidate/{name}: re-fetch code and restart instances
+	// DELETE /invalidate/{name}: tear down a deleted lambda
+	INVALIDATE_PATH = "/invalidate/"
+
 	// Registry paths - same as boss
 	// GET /registry
 	// POST /registry/{name}
 	// DELETE /registry/{name}
 	// GET /registry/{name} not implemented
 	// GET /registry/{name}/config
+	// PATCH /registry/{name}/config (merge a partial ol.yaml into the config overlay)
+	// DELETE /registry/{name}/config (drop the config overlay)
 	REGISTRY_BASE_PATH = "/registry/"
+
+	// PUT /secrets/{name} (body is the value; encrypted at rest)
+	// DELETE /secrets/{name}
+	SECRETS_PATH = "/secrets/"
 )
 
 var (
@@ -213,7 +232,7 @@ func RegistryHandler(w http.ResponseWriter, r *http.Request) {
 	// GET /registry - list all lambda functions in registry
 	if relPath == "" {
 		if r.Method == "GET" {
-			lambdaStore.ListLambda(w)
+			lambdaStore.ListLambda(w, r)
 			return
 		}
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -222,9 +241,18 @@ func RegistryHandler(w http.ResponseWriter, r *http.Request) {
 
 	parts := strings.SplitN(relPath, "/", 2)
 
-	// GET /registry/{name}/config
-	if len(parts) == 2 && parts[1] == "config" && r.Method == "GET" {
-		lambdaStore.RetrieveLambdaConfig(w, r)
+	// GET|PATCH|DELETE /registry/{name}/config
+	if len(parts) == 2 && parts[1] == "config" {
+		switch r.Method {
+		case "GET":
+			lambdaStore.RetrieveLambdaConfig(w, r)
+		case "PATCH":
+			lambdaStore.PatchLambdaConfig(w, r)
+		case "DELETE":
+			lambdaStore.DeleteLambdaConfigOverlay(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
 		return
 	}
 
@@ -326,8 +354,15 @@ func Main() error {
 		return fmt.Errorf("failed to initialize lambda store at %s: %w", common.Conf.Registry, err)
 	}
 
+	if common.Conf.Secrets_key_file != "" {
+		if err := lambdaStore.EnableSecrets(common.Conf.Secrets_key_file); err != nil {
+			return fmt.Errorf("failed to load secret key: %w", err)
+		}
+	}
+
 	// Registry handler
 	portMux.HandleFunc(REGISTRY_BASE_PATH, RegistryHandler)
+	portMux.HandleFunc(SECRETS_PATH, lambdaStore.SecretsHandler)
 
 	var backend cleanable
 	var kafkaManager *KafkaManager
@@ -350,6 +385,15 @@ func Main() error {
 		// Register Kafka management endpoint
 		portMux.HandleFunc("/kafka/register/", HandleKafkaRegister(kafkaManager, lambdaStore))
 		slog.Info("Kafka manager ready")
+
+		// uploads/deletes through this worker's own registry take
+		// effect right away, rather than after Registry_cache_ms
+		lambdaStore.SetChangeHook(func(lambdaName string, deleted bool) {
+			if deleted {
+				kafkaManager.UnregisterLambdaKafkaTriggers(lambdaName)
+			}
+			lambdaServer.onRegistryChange(lambdaName, deleted)
+		})
 	case "sock":
 		backend, err = NewSOCKServer(portMux)
 		if err != nil {
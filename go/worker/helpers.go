@@ -19,6 +19,7 @@ import (
 
 	"github.com/open-lambda/open-lambda/go/common"
 	"github.com/open-lambda/open-lambda/go/worker/embedded"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
 )
 
 
@@ -275,6 +276,29 @@ func runningToStoppedClean() error {
 	return fmt.Errorf("worker process did not stop within 60 seconds")
 }
 
+// removeChildCgroups removes the sandbox cgroups in a group, returning
+// how many could not be removed
+func removeChildCgroups(groupPath string) int {
+	files, err := os.ReadDir(groupPath)
+	if err != nil {
+		fmt.Printf("could not read cgroup group: %s\n", err.Error())
+		return 1
+	}
+
+	errorCount := 0
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "cg-") {
+			cg := filepath.Join(groupPath, file.Name())
+			fmt.Printf("Attempting to remove %s\n", cg)
+			if err := syscall.Rmdir(cg); err != nil {
+				fmt.Printf("could not remove cgroup: %s\n", err.Error())
+				errorCount += 1
+			}
+		}
+	}
+	return errorCount
+}
+
 // This function will transition the StoppedDirty state to StoppedClean state.
 // It attempts to clean up resources after detecting a dirty shutdown.
 // It cleans up cgroups and mounts associated with the OpenLambda instance at `olPath`.
@@ -307,18 +331,23 @@ func stoppedDirtyToStoppedClean(olPath string) error {
 			cgroupErrorCount += 1
 		}
 		for _, file := range files {
-			if strings.HasPrefix(file.Name(), "cg-") {
-				cg := filepath.Join(cgRoot, file.Name())
-				fmt.Printf("Attempting to remove %s\n", cg)
-				if err := syscall.Rmdir(cg); err != nil {
-					fmt.Printf("could not remove cgroup: %s\n", err.Error())
-					cgroupErrorCount += 1
-				}
+			cg := filepath.Join(cgRoot, file.Name())
+			if strings.HasPrefix(file.Name(), "lambda-") {
+				// a group of sandbox cgroups (see cpu.group_by_lambda)
+				cgroupErrorCount += removeChildCgroups(cg)
+			} else if !strings.HasPrefix(file.Name(), "cg-") {
+				continue
+			}
+			fmt.Printf("Attempting to remove %s\n", cg)
+			if err := syscall.Rmdir(cg); err != nil {
+				fmt.Printf("could not remove cgroup: %s\n", err.Error())
+				cgroupErrorCount += 1
 			}
 		}
 	}
 
 	sandboxErrorCount := 0
+	rootless := common.Conf != nil && common.Conf.Rootless.Enabled
 	// Clean up mounts associated with sandboxes
 	dirName := filepath.Join(olPath, "worker", "root-sandboxes")
 	fmt.Printf("Attempting to clean up mounts at %s\n", dirName)
@@ -340,6 +369,16 @@ func stoppedDirtyToStoppedClean(olPath string) error {
 		}
 		for _, file := range files {
 			path := filepath.Join(dirName, file.Name())
+			if rootless {
+				// the mounts were in the worker's mount namespace,
+				// which went away with it; only the dirs are left
+				fmt.Printf("Attempting to remove %s\n", path)
+				if err := os.RemoveAll(path); err != nil {
+					fmt.Printf("Could not remove mount dir: %s\n", err.Error())
+					sandboxErrorCount += 1
+				}
+				continue
+			}
 			fmt.Printf("Attempting to unmount %s\n", path)
 			if err := syscall.Unmount(path, syscall.MNT_DETACH); err != nil {
 				// Print an error if unmounting fails.
@@ -354,6 +393,13 @@ func stoppedDirtyToStoppedClean(olPath string) error {
 		}
 	}
 
+	// Clean up network namespaces and iptables rules of isolated sandboxes
+	// (rootless workers cannot create them)
+	if common.Conf != nil && !rootless {
+		fmt.Printf("Attempting to clean up sandbox networks\n")
+		sandboxErrorCount += sandbox.CleanupNetworks(common.Conf.Worker_port, common.Conf.Network.Subnet)
+	}
+
 	// If we encountered any error while cleaning up the CGroup or the sandboxes
 	// return an error
 	if cgroupErrorCount != 0 || sandboxErrorCount != 0 {
@@ -369,7 +415,9 @@ func stoppedDirtyToStoppedClean(olPath string) error {
 
 	// Attempt to unmount the main mount directory
 	fmt.Printf("Attempting to clean up main mount directory at %s\n", dirName)
-	if err := syscall.Unmount(dirName, syscall.MNT_DETACH); err != nil {
+	if rootless {
+		fmt.Printf("Rootless worker mounts are gone with its mount namespace. No need to clean up.\n")
+	} else if err := syscall.Unmount(dirName, syscall.MNT_DETACH); err != nil {
 		// Log an error if unmounting the main directory fails.
 		if errors.Is(err, syscall.EINVAL) {
 			fmt.Printf("Sandbox mount root is not mounted. No need to clean up.\n")
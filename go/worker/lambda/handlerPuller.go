@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -29,8 +30,9 @@ type HandlerPuller struct {
 }
 
 type CacheEntry struct {
-	version time.Time // blob modification time
-	path    string
+	version        time.Time // blob modification time
+	overlayVersion time.Time // config overlay modification time (zero if none)
+	path           string
 }
 
 func NewHandlerPuller(dirMaker *common.DirMaker) (*HandlerPuller, error) {
@@ -73,21 +75,36 @@ func (cp *HandlerPuller) Pull(name string) (string, error) {
 
 	key := name + common.LambdaFileExtension
 
+	// a PATCH to the lambda's config only touches the overlay, so that
+	// needs to be part of the version too
+	var overlayVersion time.Time
+	overlayAttrs, err := cp.bucket.Attributes(context.Background(), name+common.LambdaConfigOverlayExtension)
+	if err == nil {
+		overlayVersion = overlayAttrs.ModTime
+	} else if gcerrors.Code(err) != gcerrors.NotFound {
+		return "", err
+	}
+
 	attrs, err := cp.bucket.Attributes(context.Background(), key)
 	if err == nil {
 		version := attrs.ModTime
-		if cached := cp.getCache(name); cached != nil && cached.version.Equal(version) {
+		if cached := cp.getCache(name); cached != nil && cached.version.Equal(version) && cached.overlayVersion.Equal(overlayVersion) {
 			return cached.path, nil
 		}
 	}
 
 	dir, err := cp.pullFromBlob(key, name)
 	if err == nil {
+		if err := cp.pullOverlay(name, dir); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+
 		var version time.Time
 		if attrs != nil {
 			version = attrs.ModTime
 		}
-		cp.putCache(name, version, dir)
+		cp.putCache(name, version, overlayVersion, dir)
 		return dir, nil
 	} else if err != errNotFound404 {
 		return "", err
@@ -135,6 +152,24 @@ func (cp *HandlerPuller) pullFromBlob(key, lambdaName string) (string, error) {
 	return targetDir, nil
 }
 
+// pullOverlay places the lambda's config overlay (if any) in its code dir,
+// where parseMeta will apply it over ol.yaml.
+func (cp *HandlerPuller) pullOverlay(lambdaName string, codeDir string) error {
+	path := filepath.Join(codeDir, common.LambdaConfigOverlayFilename)
+	data, err := cp.bucket.ReadAll(context.Background(), lambdaName+common.LambdaConfigOverlayExtension)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		// only the registry decides what the overlay is
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read config overlay: %w", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
 func (cp *HandlerPuller) Reset(name string) {
 	cp.dirCache.Delete(name)
 }
@@ -146,10 +181,10 @@ func (cp *HandlerPuller) getCache(name string) *CacheEntry {
 	}
 	return entry.(*CacheEntry)
 }
-func (cp *HandlerPuller) putCache(name string, version time.Time, path string) {
+func (cp *HandlerPuller) putCache(name string, version time.Time, overlayVersion time.Time, path string) {
 	// Clean up old cache entry if it exists
 	if old := cp.getCache(name); old != nil && old.path != path {
 		os.RemoveAll(old.path)
 	}
-	cp.dirCache.Store(name, &CacheEntry{version, path})
+	cp.dirCache.Store(name, &CacheEntry{version, overlayVersion, path})
 }
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/open-lambda/open-lambda/go/common"
@@ -38,12 +40,21 @@ type LambdaFunc struct {
 	// lambda execution
 	funcChan  chan *Invocation // server to func
 	instChan  chan *Invocation // func to instances
+	batchChan chan *Invocation // like instChan, for batch requests
 	doneChan  chan *Invocation // instances to func
 	instances *list.List
 
 	// send chan to the kill chan to destroy the instance, then
 	// wait for msg on sent chan to block until it is done
 	killChan chan chan bool
+
+	// like killChan, but only restarts instances on fresh code
+	invalidateChan chan chan bool
+
+	// set by Kill, after which nothing may be sent to funcChan (Task
+	// won't be around to answer it)
+	killMutex sync.Mutex
+	killed    bool
 }
 
 // Invoke handles the invocation of the lambda function.
@@ -54,12 +65,22 @@ func (f *LambdaFunc) Invoke(w http.ResponseWriter, r *http.Request) {
 	done := make(chan bool)
 	req := &Invocation{w: w, r: r, done: done}
 
-	// send invocation to lambda func task, if room in queue
+	// send invocation to lambda func task, if room in queue (and the
+	// task hasn't been killed, e.g., because the lambda was deleted)
+	f.killMutex.Lock()
+	if f.killed {
+		f.killMutex.Unlock()
+		req.w.WriteHeader(http.StatusServiceUnavailable)
+		req.w.Write([]byte("lambda function was stopped\n"))
+		return
+	}
 	select {
 	case f.funcChan <- req:
+		f.killMutex.Unlock()
 		// block until it's done
 		<-done
 	default:
+		f.killMutex.Unlock()
 		// queue cannot accept more, so reply with backoff
 		req.w.WriteHeader(http.StatusTooManyRequests)
 		req.w.Write([]byte("lambda function queue is full\n"))
@@ -76,18 +97,59 @@ func (f *LambdaFunc) printf(format string, args ...any) {
 // parseMeta constructs a FunctionMeta based on contents of a code
 // directory, such as an ol.yaml and requirements.txt (generated by
 // pip-compile)
-func parseMeta(codeDir string) (*FunctionMeta, error) {
+func parseMeta(name string, codeDir string) (*FunctionMeta, error) {
 	sandboxMeta := &sandbox.SandboxMeta{
 		Installs: []string{},
 		Imports:  []string{},
 	}
 
-	// Load Lambda configuration from ol.yaml first (needed to check OL_ENTRY_FILE)
-	lambdaConfig, err := common.LoadLambdaConfig(codeDir)
+	// Load Lambda configuration from ol.yaml (plus any overlay from the
+	// registry) first (needed to check OL_ENTRY_FILE)
+	lambdaConfig, err := common.LoadLambdaConfigWithOverlay(codeDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse lambda configuration file: %v", err)
 	}
 
+	sandboxMeta.Network = lambdaConfig.Network
+	if sandboxMeta.Network == nil && common.Conf.Network.Default_mode != "" {
+		sandboxMeta.Network = &common.NetworkPolicy{Mode: common.Conf.Network.Default_mode}
+	}
+
+	sandboxMeta.Seccomp, err = sandbox.SeccompProfileFor(lambdaConfig.Seccomp)
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxMeta.Volumes, err = sandbox.ResolveVolumes(name, lambdaConfig.Volumes)
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxMeta.WritableRoot = lambdaConfig.WritableRoot
+	sandboxMeta.EvictionPriority = lambdaConfig.EvictionPriority
+	sandboxMeta.PriorityClass = lambdaConfig.Priority()
+
+	sandboxMeta.Lambda = name
+	sandboxMeta.CPUWeight = lambdaConfig.CPUWeight
+	sandboxMeta.CPUPinned = lambdaConfig.CPUPinned
+	if sandboxMeta.CPUPinned && common.Conf.CPU.Pinned_cpus == "" {
+		return nil, fmt.Errorf("lambda %s has cpu-pinned, but the worker has no cpu.pinned_cpus", name)
+	}
+
+	if lambdaConfig.Image != common.DEFAULT_IMAGE {
+		sandboxMeta.Image = lambdaConfig.Image
+	}
+	if _, err := common.Conf.Image(sandboxMeta.Image); err != nil {
+		return nil, err
+	}
+
+	limits := lambdaConfig.Limits.WithDefaults(&common.Conf.Limits)
+	sandboxMeta.ScratchMB = limits.Scratch_mb
+	sandboxMeta.IOReadMBps = limits.Io_read_mbps
+	sandboxMeta.IOWriteMBps = limits.Io_write_mbps
+	sandboxMeta.IOReadIOPS = limits.Io_read_iops
+	sandboxMeta.IOWriteIOPS = limits.Io_write_iops
+
 	// Determine the Python entry file (default to f.py)
 	pythonEntryFile := "f.py"
 	if lambdaConfig.Environment != nil {
@@ -96,9 +158,17 @@ func parseMeta(codeDir string) (*FunctionMeta, error) {
 		}
 	}
 
-	// Determine runtime type by checking for entry file or f.bin
+	// Determine runtime type: a command in ol.yaml, or by checking for
+	// entry file or f.bin
 	// TODO: support OL_ENTRY_FILE for native runtime
-	if _, err := os.Stat(filepath.Join(codeDir, pythonEntryFile)); err == nil {
+	if lambdaConfig.Runtime != nil {
+		sandboxMeta.Runtime = common.RT_CUSTOM
+		sandboxMeta.Custom = lambdaConfig.Runtime
+		sandboxMeta.Env, _ = common.SplitSecretEnv(lambdaConfig.Environment)
+		if n := lambdaConfig.MaxConcurrency(); n > 1 {
+			sandboxMeta.Env["OL_CONCURRENCY"] = strconv.Itoa(n)
+		}
+	} else if _, err := os.Stat(filepath.Join(codeDir, pythonEntryFile)); err == nil {
 		sandboxMeta.Runtime = common.RT_PYTHON
 	} else if _, err := os.Stat(filepath.Join(codeDir, "f.bin")); err == nil {
 		sandboxMeta.Runtime = common.RT_NATIVE
@@ -158,7 +228,7 @@ func (f *LambdaFunc) pullHandlerIfStale() (err error) {
 	}
 
 	// Parse meta to get runtime type and config
-	meta, err := parseMeta(codeDir)
+	meta, err := parseMeta(f.name, codeDir)
 	if err != nil {
 		return err
 	}
@@ -183,7 +253,7 @@ func (f *LambdaFunc) pullHandlerIfStale() (err error) {
 		// make sure all specified dependencies are installed
 		// (but don't recursively find others)
 		for _, pkg := range meta.Sandbox.Installs {
-			if _, err := f.lmgr.PackagePuller.GetPkg(pkg); err != nil {
+			if _, err := f.lmgr.PackagePuller.GetPkg(meta.Sandbox.Image, pkg); err != nil {
 				return err
 			}
 		}
@@ -191,11 +261,20 @@ func (f *LambdaFunc) pullHandlerIfStale() (err error) {
 		f.lmgr.DepTracer.TraceFunction(codeDir, meta.Sandbox.Installs)
 	} else if meta.Sandbox.Runtime == common.RT_NATIVE {
 		slog.Info("Got native function")
+	} else if meta.Sandbox.Runtime == common.RT_CUSTOM {
+		slog.Info("Got custom runtime function", "command", meta.Sandbox.Custom.Command)
 	}
 
-	// Write environment variables to .env file if any are specified
-	if meta.Config.Environment != nil && len(meta.Config.Environment) > 0 {
-		slog.Info("creating .env for lambda", "entries", len(meta.Config.Environment))
+	// Write environment variables to .env file if any are specified.
+	// Those referencing secrets are resolved per sandbox instead (see
+	// SecretPuller.WriteSecretEnv).
+	plainEnv, _ := common.SplitSecretEnv(meta.Config.Environment)
+	// tells the runtime it may serve several requests at once
+	if n := meta.Config.MaxConcurrency(); n > 1 {
+		plainEnv["OL_CONCURRENCY"] = strconv.Itoa(n)
+	}
+	if len(plainEnv) > 0 {
+		slog.Info("creating .env for lambda", "entries", len(plainEnv))
 		envPath := filepath.Join(codeDir, ".env")
 		envFile, err := os.Create(envPath)
 		if err != nil {
@@ -203,7 +282,7 @@ func (f *LambdaFunc) pullHandlerIfStale() (err error) {
 		}
 		defer envFile.Close()
 
-		for key, value := range meta.Config.Environment {
+		for key, value := range plainEnv {
 			// Quote the value if it contains spaces or special characters
 			if strings.ContainsAny(value, " \t\n#=") {
 				escapedValue := strings.ReplaceAll(value, `"`, `\"`)
@@ -232,7 +311,7 @@ func (f *LambdaFunc) pullHandlerIfStale() (err error) {
 //
 // each of the 4 handoffs above is over a chan.  In order, those chans are:
 // 1. LambdaFunc.funcChan
-// 2. LambdaFunc.instChan
+// 2. LambdaFunc.instChan (or batchChan)
 // 3. LambdaFunc.doneChan
 // 4. Invocation.done
 //
@@ -315,13 +394,7 @@ func (f *LambdaFunc) Task() {
 			}
 
 			if oldCodeDir != "" && oldCodeDir != f.codeDir {
-				el := f.instances.Front()
-				for el != nil {
-					waitChan := el.Value.(*LambdaInstance).AsyncKill()
-					cleanupChan <- waitChan
-					el = el.Next()
-				}
-				f.instances = list.New()
+				f.killInstances(cleanupChan)
 
 				// cleanupChan is a FIFO, so this will
 				// happen after the cleanup task waits
@@ -329,10 +402,22 @@ func (f *LambdaFunc) Task() {
 				cleanupChan <- oldCodeDir
 			}
 
+			// instances only take batch requests when no
+			// interactive ones are waiting
+			queue := f.instChan
+			if class, err := f.priorityClass(req.r); err != nil {
+				req.w.WriteHeader(http.StatusBadRequest)
+				req.w.Write([]byte(err.Error() + "\n"))
+				req.done <- true
+				continue
+			} else if class == common.PRIORITY_BATCH {
+				queue = f.batchChan
+			}
+
 			f.lmgr.DepTracer.TraceInvocation(f.codeDir)
 
 			select {
-			case f.instChan <- req:
+			case queue <- req:
 				// msg: function -> instance
 				outstandingReqs++
 			default:
@@ -350,20 +435,32 @@ func (f *LambdaFunc) Task() {
 			// msg: function -> client
 			req.done <- true
 
+		case done := <-f.invalidateChan:
+			// forget when we last pulled so we fetch the code
+			// now, then restart instances so none of them keep
+			// serving the old version
+			f.lastPull = nil
+			oldCodeDir := f.codeDir
+			if err := f.pullHandlerIfStale(); err != nil {
+				f.printf("Error pulling lambda code after invalidation: %v", err)
+			}
+
+			f.killInstances(cleanupChan)
+			if oldCodeDir != "" && oldCodeDir != f.codeDir {
+				cleanupChan <- oldCodeDir
+			}
+			done <- true
+
 		case done := <-f.killChan:
 			// signal all instances to die, then wait for
 			// cleanup task to finish and exit
-			el := f.instances.Front()
-			for el != nil {
-				waitChan := el.Value.(*LambdaInstance).AsyncKill()
-				cleanupChan <- waitChan
-				el = el.Next()
-			}
+			f.killInstances(cleanupChan)
 			if f.codeDir != "" {
 				// cleanupChan <- f.codeDir
 			}
 			close(cleanupChan)
 			<-cleanupTaskDone
+			f.drainQueues()
 			done <- true
 			return
 		}
@@ -372,18 +469,23 @@ func (f *LambdaFunc) Task() {
 
 		// AUTOSCALING STEP 1: decide how many instances we want
 
-		// let's aim to have 1 sandbox per 10ms of outstanding work
+		// let's aim to have 1 sandbox slot per 10ms of outstanding
+		// work (each instance has as many slots as the lambda's
+		// concurrency)
 		// TODO make this configurable
 		inProgressWorkMs := outstandingReqs * execMs.Avg
-		desiredInstances := inProgressWorkMs / 10
+		desiredSlots := inProgressWorkMs / 10
 
 		// if we have, say, one job that will take 100
-		// seconds, spinning up 100 instances won't do any
+		// seconds, spinning up 100 slots won't do any
 		// good, so cap by number of outstanding reqs
-		if outstandingReqs < desiredInstances {
-			desiredInstances = outstandingReqs
+		if outstandingReqs < desiredSlots {
+			desiredSlots = outstandingReqs
 		}
 
+		concurrency := f.concurrency()
+		desiredInstances := (desiredSlots + concurrency - 1) / concurrency
+
 		// always try to have one instance
 		if desiredInstances < 1 {
 			desiredInstances = 1
@@ -428,6 +530,83 @@ func (f *LambdaFunc) Task() {
 	}
 }
 
+// killInstances asynchronously kills every instance.  The cleanup task
+// receives each instance's wait chan, so anything queued on cleanupChan
+// afterwards happens only once the instances are gone.
+func (f *LambdaFunc) killInstances(cleanupChan chan any) {
+	el := f.instances.Front()
+	for el != nil {
+		waitChan := el.Value.(*LambdaInstance).AsyncKill()
+		cleanupChan <- waitChan
+		el = el.Next()
+	}
+	f.instances = list.New()
+}
+
+// drainQueues answers every request still queued for (or completed
+// by) instances of a killed LambdaFunc, so no client waits forever on a
+// Task that has exited.
+func (f *LambdaFunc) drainQueues() {
+	for {
+		select {
+		case req := <-f.doneChan:
+			req.done <- true
+		case req := <-f.instChan:
+			req.w.WriteHeader(http.StatusServiceUnavailable)
+			req.w.Write([]byte("lambda function was stopped\n"))
+			req.done <- true
+		case req := <-f.batchChan:
+			req.w.WriteHeader(http.StatusServiceUnavailable)
+			req.w.Write([]byte("lambda function was stopped\n"))
+			req.done <- true
+		case req := <-f.funcChan:
+			req.w.WriteHeader(http.StatusServiceUnavailable)
+			req.w.Write([]byte("lambda function was stopped\n"))
+			req.done <- true
+		default:
+			return
+		}
+	}
+}
+
+// priorityClass returns the class of a request: that of its
+// X-OL-Priority header, if any, or else the lambda's
+func (f *LambdaFunc) priorityClass(r *http.Request) (string, error) {
+	switch class := r.Header.Get("X-OL-Priority"); class {
+	case "":
+		return f.Meta.Config.Priority(), nil
+	case common.PRIORITY_INTERACTIVE, common.PRIORITY_BATCH:
+		return class, nil
+	default:
+		return "", fmt.Errorf("X-OL-Priority must be '%s' or '%s'", common.PRIORITY_INTERACTIVE, common.PRIORITY_BATCH)
+	}
+}
+
+// nextInvocation returns a queued request for an instance, if any,
+// preferring interactive requests to batch ones
+func (f *LambdaFunc) nextInvocation() *Invocation {
+	select {
+	case req := <-f.instChan:
+		return req
+	default:
+	}
+
+	select {
+	case req := <-f.batchChan:
+		return req
+	default:
+		return nil
+	}
+}
+
+// concurrency is how many requests each instance may have in flight
+func (f *LambdaFunc) concurrency() int {
+	if f.Meta == nil {
+		return 1
+	}
+	return f.Meta.Config.MaxConcurrency()
+}
+
 // newInstance creates a new lambda instance.
 func (f *LambdaFunc) newInstance() {
 	if f.codeDir == "" {
@@ -446,8 +625,21 @@ func (f *LambdaFunc) newInstance() {
 	go linst.Task()
 }
 
+// Invalidate makes the lambda re-fetch its code and replace all
+// instances, blocking until the old instances have been signaled.
+func (f *LambdaFunc) Invalidate() {
+	done := make(chan bool)
+	f.invalidateChan <- done
+	<-done
+}
+
 // Kill signals the lambda function to terminate all instances and perform cleanup.
 func (f *LambdaFunc) Kill() {
+	// anything already in funcChan is drained by Task
+	f.killMutex.Lock()
+	f.killed = true
+	f.killMutex.Unlock()
+
 	done := make(chan bool)
 	f.killChan <- done
 	<-done
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/open-lambda/open-lambda/go/common"
@@ -26,8 +27,13 @@ type LambdaInstance struct {
 	killChan chan chan bool
 }
 
+// reason a Sandbox is destroyed after a request fails because of an
+// OOM kill (which is then counted, see recordOOM)
+const SANDBOX_OOM = "Sandbox exceeded its memory limit"
+
 // this Task manages a single Sandbox (at any given time), and
-// forwards requests from the function queue to that Sandbox.
+// forwards requests from the function queue to that Sandbox (up to
+// the lambda's concurrency at once).
 // when there are no requests, the Sandbox is paused.
 //
 // These errors are handled as follows by Task:
@@ -39,43 +45,25 @@ func (linst *LambdaInstance) Task() {
 	f := linst.lfunc
 
 	var sb sandbox.Sandbox
+	var scratchDir string // of sb
 	var err error
 
 	for {
 		// wait for a request (blocking) before making the
 		// Sandbox ready, or kill if we receive that signal
 
-		var req *Invocation
-		select {
-		case req = <-f.instChan:
-		case killed := <-linst.killChan:
-			if sb != nil {
-				rtLog := sb.GetRuntimeLog()
-				proxyLog := sb.GetProxyLog()
-				sb.Destroy("Lambda instance kill signal received")
-
-				slog.Info("Stopped sandbox")
-
-				if common.Conf.Log_output {
-					if rtLog != "" {
-						slog.Info("Runtime output is:")
-
-						for _, line := range strings.Split(rtLog, "\n") {
-							slog.Info(fmt.Sprintf("   %s", line))
-						}
-					}
-
-					if proxyLog != "" {
-						slog.Info("Proxy output is:")
-
-						for _, line := range strings.Split(proxyLog, "\n") {
-							slog.Info(fmt.Sprintf("   %s", line))
-						}
-					}
+		req := f.nextInvocation()
+		if req == nil {
+			select {
+			case req = <-f.instChan:
+			case req = <-f.batchChan:
+			case killed := <-linst.killChan:
+				if sb != nil {
+					linst.stopSandbox(sb)
 				}
+				killed <- true
+				return
 			}
-			killed <- true
-			return
 		}
 
 		reuse := linst.meta.Config.ReuseSandbox
@@ -101,13 +89,17 @@ func (linst *LambdaInstance) Task() {
 		if sb == nil {
 			sb = nil
 
-			if f.lmgr.ZygoteProvider != nil && linst.meta.Sandbox.Runtime == common.RT_PYTHON {
-				scratchDir := f.lmgr.scratchDirs.Make(f.name)
-
-				// we don't specify parent SB, because ImportCache.Create chooses it for us
-				sb, err = f.lmgr.ZygoteProvider.Create(f.lmgr.sbPool, true, linst.codeDir, scratchDir, linst.meta.Sandbox)
+			sbMeta := linst.sandboxMeta()
+			useZygote := f.lmgr.ZygoteProvider != nil && linst.meta.Sandbox.CanForkFromZygote()
+			if useZygote && linst.meta.Sandbox.Runtime == common.RT_PYTHON {
+				scratchDir, err = linst.makeScratchDir()
+				if err == nil {
+					// we don't specify parent SB, because ImportCache.Create chooses it for us
+					sb, err = f.lmgr.ZygoteProvider.Create(f.lmgr.sbPool, true, linst.codeDir, scratchDir, sbMeta)
+				}
 				if err != nil {
 					f.printf("failed to get Sandbox from import cache")
+					linst.releaseScratchDir(scratchDir)
 					sb = nil
 				}
 			}
@@ -117,12 +109,15 @@ func (linst *LambdaInstance) Task() {
 			// import cache is either disabled or it failed
 			if sb == nil {
 				t2 := common.T0("LambdaInstance-WaitSandbox-NoImportCache")
-				scratchDir := f.lmgr.scratchDirs.Make(f.name)
-				sb, err = f.lmgr.sbPool.Create(nil, true, linst.codeDir, scratchDir, linst.meta.Sandbox)
+				scratchDir, err = linst.makeScratchDir()
+				if err == nil {
+					sb, err = f.lmgr.sbPool.Create(nil, true, linst.codeDir, scratchDir, sbMeta)
+				}
 				t2.T1()
 			}
 
 			if err != nil {
+				linst.releaseScratchDir(scratchDir)
 				linst.TrySendError(req, http.StatusInternalServerError, "could not create Sandbox: "+err.Error()+"\n", nil)
 				f.doneChan <- req
 				continue // wait for another request before retrying
@@ -132,109 +127,85 @@ func (linst *LambdaInstance) Task() {
 
 		// below here, we're guaranteed (1) sb != nil, (2) proxy != nil, (3) sb is unpaused
 
-		// serve until we incoming queue is empty
+		// serve until the incoming queue is empty, with up to
+		// `concurrency` requests in flight in the Sandbox at once
 		t = common.T0("LambdaInstance-ServeRequests")
-		for req != nil {
-			// f.printf("Forwarding request to sandbox")
-
-			t2 := common.T0("LambdaInstance-RoundTrip")
-
-			// get response from sandbox
-			url := "http://root" + req.r.RequestURI
-			httpReq, err := http.NewRequest(req.r.Method, url, req.r.Body)
-			if err != nil {
-				linst.TrySendError(req, http.StatusInternalServerError, "Could not create NewRequest: "+err.Error(), sb)
-			} else {
-				// Copy headers from original request
-				for k, vv := range req.r.Header {
-					for _, v := range vv {
-						httpReq.Header.Add(k, v)
-					}
-				}
-				// Preserve ContentLength (parsed from Content-Length header)
-				httpReq.ContentLength = req.r.ContentLength
-
-				resp, err := sb.Client().Do(httpReq)
-
-				// copy response out
-				if err != nil {
-					linst.TrySendError(req, http.StatusBadGateway, "RoundTrip failed: "+err.Error()+"\n", sb)
-					sb.Destroy("Sandbox's HTTP client returned an error")
-					sb = nil
-				} else {
-					// copy headers
-					// (adapted from copyHeaders: https://go.dev/src/net/http/httputil/reverseproxy.go)
-					for k, vv := range resp.Header {
-						for _, v := range vv {
-							req.w.Header().Add(k, v)
-						}
-					}
-					req.w.WriteHeader(resp.StatusCode)
-
-					// copy body
-					if _, err := io.Copy(req.w, resp.Body); err != nil {
-						// already used WriteHeader, so can't use that to surface on error anymore
-						msg := "reading lambda response failed: " + err.Error() + "\n"
-						f.printf("error: %s", msg)
-						linst.TrySendError(req, 0, msg, sb)
-					}
-
-					resp.Body.Close()
-				}
+		concurrency := linst.meta.Config.MaxConcurrency()
+		if !reuse {
+			// each request gets a fresh Sandbox
+			concurrency = 1
+		}
+		finished := make(chan string, concurrency)
+		inFlight := 0
+		served := 0
+		broken := "" // why sb must be destroyed, once no request uses it
+		var killed chan bool
+		for {
+			// only take more requests while there is a free slot in
+			// a working Sandbox (that is not just for one request),
+			// and we're not being killed
+			canTake := broken == "" && killed == nil && inFlight < concurrency && (reuse || served == 0)
+			if req == nil && canTake {
+				req = f.nextInvocation()
 			}
-
-			// notify instance that we're done
-			t2.T1()
-			// Record at least 1 ms of elapsed time
-			v := int(t2.Milliseconds)
-			if v == 0 {
-				req.execMs = 1
-			} else {
-				req.execMs = v
+			if req != nil {
+				inFlight++
+				served++
+				go func(sb sandbox.Sandbox, scratchDir string, req *Invocation) {
+					finished <- linst.serveRequest(sb, scratchDir, req, concurrency)
+				}(sb, scratchDir, req)
+				req = nil
+				continue
+			}
+			if inFlight == 0 {
+				break
 			}
-			f.doneChan <- req
 
-			// If reuse is disabled, destroy the sandbox after invocation.
-			if !reuse && sb != nil {
-				sb.Destroy("reuse-sandbox disabled: destroying sandbox after invocation")
-				sb = nil
+			// nil chans block forever, so we only wait for new
+			// requests if we could take them
+			var queue, batchQueue chan *Invocation
+			if canTake {
+				queue, batchQueue = f.instChan, f.batchChan
+			}
+			var killChan chan chan bool
+			if killed == nil {
+				killChan = linst.killChan
 			}
 
-			// check whether we should shutdown (non-blocking)
 			select {
-			case killed := <-linst.killChan:
-				if sb != nil {
-					rtLog := sb.GetRuntimeLog()
-					sb.Destroy("Lambda instance kill signal received")
-					slog.Info("Stopped sandbox")
-
-					if common.Conf.Log_output {
-						if rtLog != "" {
-							slog.Info("Runtime output is:")
-
-							for _, line := range strings.Split(rtLog, "\n") {
-								slog.Info(fmt.Sprintf("   %s", line))
-							}
-						}
-					}
+			case reason := <-finished:
+				inFlight--
+				if reason != "" && broken == "" {
+					// other requests may still be using sb (e.g., if
+					// just this one timed out), so let them finish
+					broken = reason
 				}
-
-				killed <- true
-				return
-			default:
+			case req = <-queue:
+			case req = <-batchQueue:
+			case killed = <-killChan:
 			}
+		}
 
-			// grab another request (non-blocking)
-			select {
-			case req = <-f.instChan:
-			default:
-				req = nil
+		// below here, no requests are in flight
+		if broken != "" {
+			if broken == SANDBOX_OOM {
+				linst.recordOOM(sb)
 			}
+			sb.Destroy(broken)
+			sb = nil
+		} else if !reuse {
+			// If reuse is disabled, destroy the sandbox after invocation.
+			sb.Shutdown("reuse-sandbox disabled: destroying sandbox after invocation")
+			sb = nil
+		}
 
-			// if sandbox was destroyed, break out so outer loop can create a new one
-			if sb == nil {
-				break
+		if killed != nil {
+			if sb != nil {
+				linst.stopSandbox(sb)
 			}
+
+			killed <- true
+			return
 		}
 
 		if sb != nil {
@@ -251,6 +222,151 @@ func (linst *LambdaInstance) Task() {
 	}
 }
 
+// serveRequest forwards req to sb, and passes it back to the
+// LambdaFunc.  If sb must be destroyed, it returns why (which the caller
+// does once no other request is using sb).  With concurrency > 1, other
+// requests may be in sb at the same time, so what one of them used
+// can't be measured.
+func (linst *LambdaInstance) serveRequest(sb sandbox.Sandbox, scratchDir string, req *Invocation, concurrency int) (broken string) {
+	f := linst.lfunc
+
+	t2 := common.T0("LambdaInstance-RoundTrip")
+
+	// nil unless the Sandbox measured what the request used
+	var usage *sandbox.Usage
+	served := false
+
+	// get response from sandbox
+	url := "http://root" + req.r.RequestURI
+	httpReq, err := http.NewRequest(req.r.Method, url, req.r.Body)
+	if err != nil {
+		linst.TrySendError(req, http.StatusInternalServerError, "Could not create NewRequest: "+err.Error(), sb)
+	} else {
+		// Copy headers from original request
+		for k, vv := range req.r.Header {
+			for _, v := range vv {
+				httpReq.Header.Add(k, v)
+			}
+		}
+		// Preserve ContentLength (parsed from Content-Length header)
+		httpReq.ContentLength = req.r.ContentLength
+
+		// usage is per Sandbox, so it can only be pinned on
+		// a request that has the Sandbox to itself
+		var stopUsage func() (sandbox.Usage, error)
+		if concurrency == 1 {
+			if stop, err := sb.StartUsage(); err == nil {
+				stopUsage = stop
+			}
+		}
+		resp, err := sb.Client().Do(httpReq)
+		if stopUsage != nil {
+			usage = linst.stopUsage(stopUsage)
+		}
+		served = true
+
+		// copy response out
+		if err != nil {
+			// an OOM kill is the most likely reason the
+			// runtime died, so that is reported instead
+			if oomMsg := linst.oomMsg(sb); oomMsg != "" {
+				req.w.Header().Set("X-OL-Error", "oom")
+				linst.TrySendError(req, http.StatusInternalServerError, oomMsg+"\n", sb)
+				broken = SANDBOX_OOM
+			} else {
+				msg := "RoundTrip failed: " + err.Error() + "\n"
+				if quotaMsg := linst.scratchQuotaMsg(scratchDir); quotaMsg != "" {
+					msg += quotaMsg + "\n"
+				}
+				linst.TrySendError(req, http.StatusBadGateway, msg, sb)
+				broken = "Sandbox's HTTP client returned an error"
+			}
+		} else {
+			// copy headers
+			// (adapted from copyHeaders: https://go.dev/src/net/http/httputil/reverseproxy.go)
+			for k, vv := range resp.Header {
+				for _, v := range vv {
+					req.w.Header().Add(k, v)
+				}
+			}
+			if usage != nil {
+				req.w.Header().Set("X-OL-CPU-Usec", strconv.FormatInt(usage.CPUUsec, 10))
+				req.w.Header().Set("X-OL-Mem-Peak-MB", strconv.Itoa(usage.MemPeakMB))
+			}
+
+			// a lambda that fails with a full scratch dir most
+			// likely failed because of that, so say so first
+			quotaMsg := ""
+			if resp.StatusCode >= 500 {
+				quotaMsg = linst.scratchQuotaMsg(scratchDir)
+			}
+			if quotaMsg != "" {
+				req.w.Header().Del("Content-Length")
+				req.w.WriteHeader(http.StatusInsufficientStorage)
+				req.w.Write([]byte(quotaMsg + "\n"))
+			} else {
+				req.w.WriteHeader(resp.StatusCode)
+			}
+
+			// copy body
+			if _, err := io.Copy(req.w, resp.Body); err != nil {
+				// already used WriteHeader, so can't use that to surface on error anymore
+				msg := "reading lambda response failed: " + err.Error() + "\n"
+				f.printf("error: %s", msg)
+				linst.TrySendError(req, 0, msg, sb)
+			}
+
+			resp.Body.Close()
+		}
+	}
+
+	// notify instance that we're done
+	t2.T1()
+	// Record at least 1 ms of elapsed time
+	v := int(t2.Milliseconds)
+	if v == 0 {
+		req.execMs = 1
+	} else {
+		req.execMs = v
+	}
+	if served {
+		f.lmgr.Usage.Record(f.name, req.execMs, usage)
+	}
+	if usage != nil {
+		f.lmgr.Rightsizer.Record(f.name, req.execMs, usage)
+	}
+	f.doneChan <- req
+	return broken
+}
+
+// stopSandbox shuts sb down for good, logging its output if
+// log_output is on
+func (linst *LambdaInstance) stopSandbox(sb sandbox.Sandbox) {
+	rtLog := sb.GetRuntimeLog()
+	proxyLog := sb.GetProxyLog()
+	sb.Shutdown("Lambda instance kill signal received")
+
+	slog.Info("Stopped sandbox")
+
+	if common.Conf.Log_output {
+		if rtLog != "" {
+			slog.Info("Runtime output is:")
+
+			for _, line := range strings.Split(rtLog, "\n") {
+				slog.Info(fmt.Sprintf("   %s", line))
+			}
+		}
+
+		if proxyLog != "" {
+			slog.Info("Proxy output is:")
+
+			for _, line := range strings.Split(proxyLog, "\n") {
+				slog.Info(fmt.Sprintf("   %s", line))
+			}
+		}
+	}
+}
+
 // TrySendError attempts to send an error response to the client.
 func (linst *LambdaInstance) TrySendError(req *Invocation, statusCode int, msg string, sb sandbox.Sandbox) {
 	if statusCode > 0 {
@@ -269,6 +385,29 @@ func (linst *LambdaInstance) TrySendError(req *Invocation, statusCode int, msg s
 	}
 }
 
+// sandboxMeta is the meta for a new Sandbox: the lambda's, with the
+// recommended limits if rightsizing.auto_apply is on
+func (linst *LambdaInstance) sandboxMeta() *sandbox.SandboxMeta {
+	if !common.Conf.Rightsizing.Auto_apply {
+		return linst.meta.Sandbox
+	}
+
+	meta := *linst.meta.Sandbox
+	linst.lfunc.lmgr.Rightsizer.Apply(linst.lfunc.name, &meta)
+	return &meta
+}
+
+// stopUsage stops measuring a request's usage.  It is measured up to
+// when the response headers arrive, as they carry it.
+func (linst *LambdaInstance) stopUsage(stop func() (sandbox.Usage, error)) *sandbox.Usage {
+	usage, err := stop()
+	if err != nil {
+		linst.lfunc.printf("could not measure usage: %v", err)
+		return nil
+	}
+	return &usage
+}
+
 // AsyncKill signals the instance to die, return chan that can be used to block
 // until it's done
 func (linst *LambdaInstance) AsyncKill() chan bool {
@@ -276,3 +415,62 @@ func (linst *LambdaInstance) AsyncKill() chan bool {
 	linst.killChan <- done
 	return done
 }
+
+// makeScratchDir creates the scratch dir for a new sandbox, with any
+// secrets the lambda references resolved into it
+func (linst *LambdaInstance) makeScratchDir() (string, error) {
+	f := linst.lfunc
+	scratchDir := f.lmgr.scratchDirs.Make(f.name)
+	if err := sandbox.MountScratchQuota(scratchDir, linst.meta.Sandbox.ScratchMB); err != nil {
+		return "", err
+	}
+	if err := f.lmgr.secrets.WriteSecretEnv(linst.meta.Config.Environment, scratchDir); err != nil {
+		linst.releaseScratchDir(scratchDir)
+		return "", fmt.Errorf("could not resolve secrets: %w", err)
+	}
+	return scratchDir, nil
+}
+
+// releaseScratchDir releases the quota of a scratch dir that did not end up
+// with a Sandbox (Sandboxes release their own on Destroy)
+func (linst *LambdaInstance) releaseScratchDir(scratchDir string) {
+	if scratchDir == "" || linst.meta.Sandbox.ScratchMB <= 0 {
+		return
+	}
+	if err := sandbox.ReleaseScratchQuota(scratchDir); err != nil {
+		linst.lfunc.printf("could not release scratch dir: %v", err)
+	}
+}
+
+// oomMsg explains a failure by the kernel having killed processes in
+// the Sandbox for exceeding its memory limit, if it did
+func (linst *LambdaInstance) oomMsg(sb sandbox.Sandbox) string {
+	kills, err := sb.OOMKills()
+	if err != nil || kills == 0 {
+		return ""
+	}
+	return fmt.Sprintf("lambda exceeded %d MB memory limit", sb.Meta().MemLimitMB)
+}
+
+// recordOOM counts the OOM kill of sb (once, however many requests
+// it failed)
+func (linst *LambdaInstance) recordOOM(sb sandbox.Sandbox) {
+	kills, err := sb.OOMKills()
+	if err != nil {
+		return
+	}
+
+	f := linst.lfunc
+	f.printf("sandbox %s was OOM killed (%d processes)", sb.ID(), kills)
+	common.Count("oom-kills/" + f.name)
+	f.lmgr.ooms.Record(f.name, sb.ID(), sb.Meta().MemLimitMB, kills)
+	f.lmgr.Rightsizer.RecordOOM(f.name)
+}
+
+// scratchQuotaMsg explains a failure by the scratch dir being full, if it is
+func (linst *LambdaInstance) scratchQuotaMsg(scratchDir string) string {
+	if !sandbox.ScratchQuotaExceeded(scratchDir, linst.meta.Sandbox) {
+		return ""
+	}
+	return fmt.Sprintf("lambda exceeded its %d MB scratch quota (/tmp and /host)", linst.meta.Sandbox.ScratchMB)
+}
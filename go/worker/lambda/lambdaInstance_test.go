@@ -0,0 +1,137 @@
+package lambda
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
+)
+
+// fakeSandbox answers every request with a 200, and records whether it
+// was shut down.  Methods Task doesn't use are left to the embedded
+// (nil) interface.
+type fakeSandbox struct {
+	sandbox.Sandbox
+	id   string
+	meta *sandbox.SandboxMeta
+
+	mutex    sync.Mutex
+	shutdown bool
+}
+
+func (sb *fakeSandbox) ID() string                 { return sb.id }
+func (sb *fakeSandbox) Meta() *sandbox.SandboxMeta { return sb.meta }
+func (sb *fakeSandbox) Pause() error               { return nil }
+func (sb *fakeSandbox) Unpause() error             { return nil }
+func (sb *fakeSandbox) Destroy(reason string)      {}
+func (sb *fakeSandbox) DebugString() string        { return sb.id }
+func (sb *fakeSandbox) GetRuntimeLog() string      { return "" }
+func (sb *fakeSandbox) GetProxyLog() string        { return "" }
+func (sb *fakeSandbox) OOMKills() (int64, error)   { return 0, nil }
+func (sb *fakeSandbox) Shutdown(reason string) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	sb.shutdown = true
+}
+
+func (sb *fakeSandbox) StartUsage() (func() (sandbox.Usage, error), error) {
+	return nil, fmt.Errorf("usage not supported by fakeSandbox")
+}
+
+func (sb *fakeSandbox) Client() *http.Client {
+	return &http.Client{Transport: sb}
+}
+
+// RoundTrip answers with the sandbox's ID, so tests can tell which
+// Sandbox served a request
+func (sb *fakeSandbox) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(sb.id)),
+		Request:    req,
+	}, nil
+}
+
+// fakePool creates fakeSandboxes, and remembers them
+type fakePool struct {
+	sandbox.SandboxPool
+
+	mutex     sync.Mutex
+	sandboxes []*fakeSandbox
+}
+
+func (pool *fakePool) Create(parent sandbox.Sandbox, isLeaf bool, codeDir, scratchDir string, meta *sandbox.SandboxMeta) (sandbox.Sandbox, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	sb := &fakeSandbox{id: fmt.Sprintf("sb-%d", len(pool.sandboxes)+1), meta: meta}
+	pool.sandboxes = append(pool.sandboxes, sb)
+	return sb, nil
+}
+
+// TestInstanceNoReuse verifies that with reuse-sandbox off, requests
+// that are already queued still each get a fresh Sandbox.
+func TestInstanceNoReuse(t *testing.T) {
+	common.Conf = &common.Config{Worker_dir: t.TempDir()}
+	scratchDirs, err := common.NewDirMaker("scratch", common.STORE_REGULAR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &fakePool{}
+	mgr := &LambdaMgr{
+		sbPool:      pool,
+		Usage:       NewUsageLedger(),
+		Rightsizer:  NewRightsizer(),
+		scratchDirs: scratchDirs,
+	}
+	f := &LambdaFunc{
+		lmgr:      mgr,
+		name:      "f",
+		instChan:  make(chan *Invocation, 2),
+		batchChan: make(chan *Invocation, 2),
+		doneChan:  make(chan *Invocation, 2),
+		instances: list.New(),
+	}
+	linst := &LambdaInstance{
+		lfunc: f,
+		meta: &FunctionMeta{
+			Config:  &common.LambdaConfig{ReuseSandbox: false},
+			Sandbox: &sandbox.SandboxMeta{},
+		},
+		killChan: make(chan chan bool, 1),
+	}
+
+	var recorders []*httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		recorders = append(recorders, w)
+		r := httptest.NewRequest("POST", "/run/f", nil)
+		f.instChan <- &Invocation{w: w, r: r, done: make(chan bool, 1)}
+	}
+
+	go linst.Task()
+	for i := 0; i < 2; i++ {
+		<-f.doneChan
+	}
+	<-linst.AsyncKill()
+
+	if len(pool.sandboxes) != 2 {
+		t.Fatalf("expected 2 sandboxes, got %d", len(pool.sandboxes))
+	}
+	if recorders[0].Body.String() == recorders[1].Body.String() {
+		t.Errorf("both requests were served by %s", recorders[0].Body.String())
+	}
+	for _, sb := range pool.sandboxes {
+		if !sb.shutdown {
+			t.Errorf("%s was not shut down", sb.id)
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/open-lambda/open-lambda/go/common"
 	"github.com/open-lambda/open-lambda/go/worker/lambda/packages"
@@ -25,6 +27,18 @@ type LambdaMgr struct {
 	zygote.ZygoteProvider   // depends PackagePuller
 	*HandlerPuller          // depends on sbPool and ImportCache[optional]
 
+	// nil if no secrets_key_file is configured
+	secrets *SecretPuller
+
+	// per-lambda, per-hour resource usage (see /usage)
+	Usage *UsageLedger
+
+	// recommended limits for each lambda (see /recommendations)
+	Rightsizer *Rightsizer
+
+	// recent OOM kills, for Debug
+	ooms oomLog
+
 	// storage dirs that we manage
 	codeDirs    *common.DirMaker
 	scratchDirs *common.DirMaker
@@ -69,7 +83,9 @@ func GetLambdaManagerInstance() (*LambdaMgr, error) {
 // This is private to force packages to use the singleton method GetLambdaManagerInstance
 func newLambdaMgr() (res *LambdaMgr, err error) {
 	mgr := &LambdaMgr{
-		lfuncMap: make(map[string]*LambdaFunc),
+		lfuncMap:   make(map[string]*LambdaFunc),
+		Usage:      NewUsageLedger(),
+		Rightsizer: NewRightsizer(),
 	}
 	defer func() {
 		if err != nil {
@@ -119,6 +135,14 @@ func newLambdaMgr() (res *LambdaMgr, err error) {
 		return nil, err
 	}
 
+	if common.Conf.Secrets_key_file != "" {
+		slog.Info("Creating SecretPuller")
+		mgr.secrets, err = NewSecretPuller(mgr.HandlerPuller.bucket, common.Conf.Secrets_key_file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return mgr, nil
 }
 
@@ -136,9 +160,12 @@ func (mgr *LambdaMgr) Get(name string) (f *LambdaFunc) {
 			// TODO make these configurable
 			funcChan:  make(chan *Invocation, 1024),
 			instChan:  make(chan *Invocation, 1024),
+			batchChan: make(chan *Invocation, 1024),
 			doneChan:  make(chan *Invocation, 1024),
 			instances: list.New(),
 			killChan:  make(chan chan bool, 1),
+
+			invalidateChan: make(chan chan bool, 1),
 		}
 
 		go f.Task()
@@ -148,9 +175,48 @@ func (mgr *LambdaMgr) Get(name string) (f *LambdaFunc) {
 	return f
 }
 
+// Invalidate drops the cached code of a lambda and, if the lambda has
+// been used on this worker, restarts its instances on the latest code.
+// It is a no-op for lambdas this worker has never run.
+func (mgr *LambdaMgr) Invalidate(name string) {
+	mgr.HandlerPuller.Reset(name)
+
+	mgr.mapMutex.Lock()
+	f := mgr.lfuncMap[name]
+	mgr.mapMutex.Unlock()
+
+	if f != nil {
+		f.Invalidate()
+	}
+}
+
+// Remove tears down a lambda that was deleted from the registry: its
+// instances are killed, it is dropped from the map (so a later request
+// starts from scratch), and its cached code is deleted.
+func (mgr *LambdaMgr) Remove(name string) {
+	mgr.HandlerPuller.Reset(name)
+
+	mgr.mapMutex.Lock()
+	f := mgr.lfuncMap[name]
+	delete(mgr.lfuncMap, name)
+	mgr.mapMutex.Unlock()
+
+	if f == nil {
+		return
+	}
+
+	f.printf("removing deleted lambda")
+	f.Kill()
+	if f.codeDir != "" {
+		if err := os.RemoveAll(f.codeDir); err != nil {
+			f.printf("could not delete code dir %s: %v", f.codeDir, err)
+		}
+	}
+}
+
 // Debug returns the debug information of the sandbox pool.
 func (mgr *LambdaMgr) Debug() string {
-	return mgr.sbPool.DebugString() + "\n"
+	return mgr.sbPool.DebugString() + "\n" + mgr.ooms.DebugString()
 }
 
 // DumpStatsToLog logs the profiling information of the LambdaMgr.
@@ -202,10 +268,19 @@ func (mgr *LambdaMgr) Cleanup() {
 	// 1. cleanup handler Sandboxes
 	// 2. cleanup Zygote Sandboxes (after the handlers, which depend on the Zygotes)
 	// 3. cleanup SandboxPool underlying both of above
+	// every lambda is killed at once, and their Sandboxes share one
+	// grace period, so that the worker exits within it
+	sandbox.EndShutdownsBy(time.Now().Add(time.Duration(common.Conf.Shutdown_grace_ms) * time.Millisecond))
+	var wg sync.WaitGroup
 	for _, f := range mgr.lfuncMap {
-		slog.Info(fmt.Sprintf("Kill function: %s", f.name))
-		f.Kill()
+		wg.Add(1)
+		go func(f *LambdaFunc) {
+			defer wg.Done()
+			slog.Info(fmt.Sprintf("Kill function: %s", f.name))
+			f.Kill()
+		}(f)
 	}
+	wg.Wait()
 
 	if mgr.ZygoteProvider != nil {
 		mgr.ZygoteProvider.Cleanup()
@@ -0,0 +1,55 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how many OOM events LambdaMgr.Debug shows
+const OOM_LOG_SIZE = 32
+
+// oomLog remembers the most recent times a lambda's Sandbox was killed
+// for exceeding its memory limit.  It is safe for concurrent use.
+type oomLog struct {
+	sync.Mutex
+	events []oomEvent
+}
+
+type oomEvent struct {
+	time       time.Time
+	lambda     string
+	sandboxID  string
+	memLimitMB int
+	kills      int64
+}
+
+func (log *oomLog) Record(lambda, sandboxID string, memLimitMB int, kills int64) {
+	log.Lock()
+	defer log.Unlock()
+
+	log.events = append(log.events, oomEvent{time.Now(), lambda, sandboxID, memLimitMB, kills})
+	if len(log.events) > OOM_LOG_SIZE {
+		log.events = log.events[len(log.events)-OOM_LOG_SIZE:]
+	}
+}
+
+// DebugString lists the events, newest first
+func (log *oomLog) DebugString() string {
+	log.Lock()
+	defer log.Unlock()
+
+	if len(log.events) == 0 {
+		return "RECENT OOM KILLS: none\n"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("RECENT OOM KILLS:\n")
+	for i := len(log.events) - 1; i >= 0; i-- {
+		ev := log.events[i]
+		sb.WriteString(fmt.Sprintf("  %s: lambda %s exceeded %d MB in SB %s (%d processes killed)\n",
+			ev.time.Format(time.RFC3339), ev.lambda, ev.memLimitMB, ev.sandboxID, ev.kills))
+	}
+	return sb.String()
+}
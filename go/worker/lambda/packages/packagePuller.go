@@ -28,11 +28,19 @@ type PackagePuller struct {
 	// directory of lambda code that installs pip packages
 	pipLambda string
 
-	packages sync.Map
+	packages sync.Map // pkgKey -> *Package
+}
+
+// packages are installed separately for each base image, so that
+// compiled code matches the image's Python
+type pkgKey struct {
+	image string
+	name  string
 }
 
 type Package struct {
 	Name         string
+	Image        string // base image the package is installed for
 	Meta         PackageMeta
 	installMutex sync.Mutex
 	installed    uint32
@@ -78,8 +86,9 @@ func NormalizePkg(pkg string) string {
 	return strings.ReplaceAll(strings.ToLower(pkg), "_", "-")
 }
 
-// InstallRecursive installs the specified packages and their dependencies recursively.
-func (pp *PackagePuller) InstallRecursive(installs []string) ([]string, error) {
+// InstallRecursive installs the specified packages and their dependencies
+// recursively, for the given base image.
+func (pp *PackagePuller) InstallRecursive(image string, installs []string) ([]string, error) {
 	// shrink capacity to length so that our appends are not
 	// visible to caller
 	installs = installs[:len(installs):len(installs)]
@@ -97,7 +106,7 @@ func (pp *PackagePuller) InstallRecursive(installs []string) ([]string, error) {
 		if common.Conf.Trace.Package {
 			slog.Info(fmt.Sprintf("On %v of %v", pkg, installs))
 		}
-		p, err := pp.GetPkg(pkg)
+		p, err := pp.GetPkg(image, pkg)
 		if err != nil {
 			return nil, err
 		}
@@ -119,11 +128,12 @@ func (pp *PackagePuller) InstallRecursive(installs []string) ([]string, error) {
 	return installs, nil
 }
 
-// GetPkg retrieves the specified package, installing it if necessary.
-func (pp *PackagePuller) GetPkg(pkg string) (*Package, error) {
+// GetPkg retrieves the specified package for a base image ("" for the
+// default image), installing it if necessary.
+func (pp *PackagePuller) GetPkg(image string, pkg string) (*Package, error) {
 	// get (or create) package
 	pkg = NormalizePkg(pkg)
-	tmp, _ := pp.packages.LoadOrStore(pkg, &Package{Name: pkg})
+	tmp, _ := pp.packages.LoadOrStore(pkgKey{image, pkg}, &Package{Name: pkg, Image: image})
 	p := tmp.(*Package)
 
 	// fast path
@@ -155,7 +165,11 @@ func (pp *PackagePuller) sandboxInstall(p *Package) (err error) {
 	// the pip-install lambda installs to /host, which is the the
 	// same as scratchDir, which is the same as a sub-directory
 	// named after the package in the packages dir
-	scratchDir := filepath.Join(common.Conf.Pkgs_dir, p.Name)
+	img, err := common.Conf.Image(p.Image)
+	if err != nil {
+		return err
+	}
+	scratchDir := filepath.Join(img.Pkgs_dir, p.Name)
 	slog.Info(fmt.Sprintf("do pip install, using scratchDir='%v'", scratchDir))
 
 	alreadyInstalled := false
@@ -165,7 +179,7 @@ func (pp *PackagePuller) sandboxInstall(p *Package) (err error) {
 		alreadyInstalled = true
 	} else {
 		slog.Info(fmt.Sprintf("run pip install %s from a new Sandbox to %s on host", p.Name, scratchDir))
-		if err := os.Mkdir(scratchDir, 0700); err != nil {
+		if err := os.MkdirAll(scratchDir, 0700); err != nil {
 			return err
 		}
 	}
@@ -182,6 +196,7 @@ func (pp *PackagePuller) sandboxInstall(p *Package) (err error) {
 	meta := &sandbox.SandboxMeta{
 		Runtime:    common.RT_PYTHON,
 		MemLimitMB: inst.Mem_mb,
+		Image:      p.Image,
 	}
 	sb, err := pp.sbPool.Create(nil, true, pp.pipLambda, scratchDir, meta)
 	if err != nil {
@@ -0,0 +1,172 @@
+package lambda
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
+)
+
+// how many recent invocations of each lambda recommendations are based on
+const RIGHTSIZING_SAMPLES = 1000
+
+// Rightsizer recommends memory and CPU limits for each lambda from the
+// usage of its recent invocations, and (with rightsizing.auto_apply)
+// supplies them for new sandboxes.  It is safe for concurrent use.
+type Rightsizer struct {
+	sync.Mutex
+	lambdas map[string]*lambdaSamples
+}
+
+type lambdaSamples struct {
+	// ring buffers of the last RIGHTSIZING_SAMPLES invocations
+	memPeakMB  []int
+	cpuPercent []int
+	next       int
+
+	// a sandbox of this lambda was OOM killed, so we stop applying
+	// recommendations to it (at least until the worker restarts)
+	oomKilled bool
+}
+
+func NewRightsizer() *Rightsizer {
+	return &Rightsizer{lambdas: make(map[string]*lambdaSamples)}
+}
+
+// Record the usage of an invocation that took execMs
+func (rs *Rightsizer) Record(lambda string, execMs int, usage *sandbox.Usage) {
+	cpuPercent := int(usage.CPUUsec / int64(execMs*10))
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	samples := rs.samples(lambda)
+	if len(samples.memPeakMB) < RIGHTSIZING_SAMPLES {
+		samples.memPeakMB = append(samples.memPeakMB, usage.MemPeakMB)
+		samples.cpuPercent = append(samples.cpuPercent, cpuPercent)
+	} else {
+		samples.memPeakMB[samples.next] = usage.MemPeakMB
+		samples.cpuPercent[samples.next] = cpuPercent
+	}
+	samples.next = (samples.next + 1) % RIGHTSIZING_SAMPLES
+}
+
+// RecordOOM notes that a sandbox of lambda ran out of memory
+func (rs *Rightsizer) RecordOOM(lambda string) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.samples(lambda).oomKilled = true
+}
+
+// caller holds the lock
+func (rs *Rightsizer) samples(lambda string) *lambdaSamples {
+	samples, ok := rs.lambdas[lambda]
+	if !ok {
+		samples = &lambdaSamples{}
+		rs.lambdas[lambda] = samples
+	}
+	return samples
+}
+
+// Recommend limits for one lambda
+func (rs *Rightsizer) Recommend(lambda string) common.Recommendation {
+	rs.Lock()
+	defer rs.Unlock()
+	return rs.recommend(lambda, rs.samples(lambda))
+}
+
+// RecommendAll recommends limits for every lambda with samples, sorted
+// by name
+func (rs *Rightsizer) RecommendAll() []common.Recommendation {
+	rs.Lock()
+	defer rs.Unlock()
+
+	recs := []common.Recommendation{}
+	for lambda, samples := range rs.lambdas {
+		recs = append(recs, rs.recommend(lambda, samples))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Lambda < recs[j].Lambda
+	})
+	return recs
+}
+
+// Apply sets the limits of meta (in place) to the lambda's
+// recommendation, if it should be applied
+func (rs *Rightsizer) Apply(lambda string, meta *sandbox.SandboxMeta) {
+	rec := rs.Recommend(lambda)
+	if rec.Applied {
+		meta.MemLimitMB = rec.Mem_mb
+		meta.CPUPercent = rec.CPU_percent
+	}
+}
+
+// caller holds the lock
+func (rs *Rightsizer) recommend(lambda string, samples *lambdaSamples) common.Recommendation {
+	cfg := &common.Conf.Rightsizing
+	minSamples := defaultInt(cfg.Min_samples, 20)
+	headroom := defaultInt(cfg.Headroom_percent, 25)
+
+	rec := common.Recommendation{
+		Lambda:         lambda,
+		Samples:        len(samples.memPeakMB),
+		MemPeakMB:      percentiles(samples.memPeakMB),
+		CPUUsedPercent: percentiles(samples.cpuPercent),
+	}
+	if rec.Samples < minSamples {
+		rec.Note = "too few invocations with measured usage"
+		return rec
+	}
+
+	// rounded up to multiples of 8 MB and 5%, so recommendations don't
+	// change with every sample
+	mem := roundUp(rec.MemPeakMB.P99*(100+headroom)/100, 8)
+	rec.Mem_mb = clamp(mem, defaultInt(cfg.Min_mem_mb, 16), common.Conf.Limits.Mem_mb)
+	cpu := roundUp(rec.CPUUsedPercent.P99*(100+headroom)/100, 5)
+	rec.CPU_percent = clamp(cpu, defaultInt(cfg.Min_cpu_percent, 10), common.Conf.Limits.CPU_percent)
+
+	if !cfg.Auto_apply {
+		rec.Note = "rightsizing.auto_apply is off"
+	} else if samples.oomKilled {
+		rec.Note = "not applied, as a sandbox was OOM killed"
+	} else {
+		rec.Applied = true
+	}
+	return rec
+}
+
+func percentiles(samples []int) common.Percentiles {
+	if len(samples) == 0 {
+		return common.Percentiles{}
+	}
+
+	sorted := append([]int(nil), samples...)
+	sort.Ints(sorted)
+	at := func(p int) int {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return common.Percentiles{P50: at(50), P95: at(95), P99: at(99), Max: sorted[len(sorted)-1]}
+}
+
+func defaultInt(val, def int) int {
+	if val == 0 {
+		return def
+	}
+	return val
+}
+
+func roundUp(val, multiple int) int {
+	return (val + multiple - 1) / multiple * multiple
+}
+
+// clamp val to [min, max], or to max if min > max
+func clamp(val, min, max int) int {
+	if val < min {
+		val = min
+	}
+	if val > max {
+		val = max
+	}
+	return val
+}
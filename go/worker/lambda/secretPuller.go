@@ -0,0 +1,80 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
+)
+
+// SecretPuller decrypts secrets from the registry for the lambdas that
+// reference them.  Secrets are fetched again for every new sandbox (rather
+// than cached) so that updates and deletions take effect right away.
+type SecretPuller struct {
+	bucket *blob.Bucket
+	key    []byte
+}
+
+func NewSecretPuller(bucket *blob.Bucket, keyPath string) (*SecretPuller, error) {
+	key, err := common.LoadSecretKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretPuller{bucket: bucket, key: key}, nil
+}
+
+func (sp *SecretPuller) Get(name string) (string, error) {
+	if err := common.ValidateSecretName(name); err != nil {
+		return "", err
+	}
+
+	data, err := sp.bucket.ReadAll(context.Background(), common.SecretKeyPrefix+name)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return "", fmt.Errorf("secret %s not found", name)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	value, err := common.DecryptSecret(sp.key, name, data)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// WriteSecretEnv resolves the environment variables that reference
+// secrets and writes them to the sandbox's scratch dir, where the runtime
+// loads them at startup.  The code dir is shared by every instance (and
+// visible to anybody who can pull the code), so secrets never go there.
+func (sp *SecretPuller) WriteSecretEnv(env map[string]string, scratchDir string) error {
+	_, secretEnv := common.SplitSecretEnv(env)
+	if len(secretEnv) == 0 {
+		return nil
+	}
+
+	if sp == nil {
+		return fmt.Errorf("lambda references secrets, but the worker has no secrets_key_file")
+	}
+
+	resolved := make(map[string]string, len(secretEnv))
+	for key, value := range secretEnv {
+		value, err := common.ResolveSecretRefs(value, sp.Get)
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		resolved[key] = value
+	}
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(scratchDir, sandbox.SECRETS_ENV_NAME), data, 0600)
+}
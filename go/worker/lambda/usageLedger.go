@@ -0,0 +1,77 @@
+package lambda
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox"
+)
+
+// how many hours of usage a worker remembers (the boss should
+// collect it before then)
+const USAGE_LEDGER_HOURS = 7 * 24
+
+// UsageLedger totals what each lambda used, per hour, for billing.  It
+// is safe for concurrent use (each LambdaInstance records to it).
+type UsageLedger struct {
+	sync.Mutex
+	records map[usageKey]*common.UsageRecord
+}
+
+type usageKey struct {
+	lambda string
+	hour   int64 // unix time of the start of the hour
+}
+
+func NewUsageLedger() *UsageLedger {
+	return &UsageLedger{records: make(map[usageKey]*common.UsageRecord)}
+}
+
+// Record an invocation of lambda that took execMs.  usage is nil if
+// the Sandbox couldn't measure it.
+func (ledger *UsageLedger) Record(lambda string, execMs int, usage *sandbox.Usage) {
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	ledger.Lock()
+	defer ledger.Unlock()
+
+	key := usageKey{lambda, hour.Unix()}
+	record, ok := ledger.records[key]
+	if !ok {
+		record = &common.UsageRecord{Lambda: lambda, Hour: hour}
+		ledger.records[key] = record
+		ledger.prune(hour)
+	}
+
+	record.Invocations += 1
+	if usage == nil {
+		record.Unmetered += 1
+		return
+	}
+	record.CPUUsec += usage.CPUUsec
+	record.MemMBMs += int64(usage.MemPeakMB) * int64(execMs)
+	record.MaxMemPeakMB = common.Max(record.MaxMemPeakMB, usage.MemPeakMB)
+}
+
+// prune drops hours that are too old to keep (caller holds the lock)
+func (ledger *UsageLedger) prune(now time.Time) {
+	oldest := now.Add(-USAGE_LEDGER_HOURS * time.Hour).Unix()
+	for key := range ledger.records {
+		if key.hour < oldest {
+			delete(ledger.records, key)
+		}
+	}
+}
+
+// Snapshot returns all records, sorted by lambda, then hour
+func (ledger *UsageLedger) Snapshot() []common.UsageRecord {
+	ledger.Lock()
+	defer ledger.Unlock()
+
+	records := make([]common.UsageRecord, 0, len(ledger.records))
+	for _, record := range ledger.records {
+		records = append(records, *record)
+	}
+	return common.SumUsage(records)
+}
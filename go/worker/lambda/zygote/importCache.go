@@ -19,6 +19,7 @@ type ImportCache struct {
 	scratchDirs *common.DirMaker
 	pkgPuller   *packages.PackagePuller
 	sbPool      sandbox.SandboxPool
+	image       string // base image of all Zygotes in the tree
 	root        *ImportCacheNode
 }
 
@@ -65,12 +66,13 @@ type ZygoteReq struct {
 }
 
 // NewImportCache creates a new ImportCache instance and initializes it with the given parameters.
-func NewImportCache(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPool sandbox.SandboxPool, pp *packages.PackagePuller) (ic *ImportCache, err error) {
+func NewImportCache(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPool sandbox.SandboxPool, pp *packages.PackagePuller, image string) (ic *ImportCache, err error) {
 	cache := &ImportCache{
 		codeDirs:    codeDirs,
 		scratchDirs: scratchDirs,
 		sbPool:      sbPool,
 		pkgPuller:   pp,
+		image:       image,
 	}
 
 	// a static tree of Zygotes may be specified by a file (if so, parse and init it)
@@ -109,7 +111,7 @@ func NewImportCache(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbP
 		return nil, fmt.Errorf("root node in import cache may not import packages\n")
 	}
 	cache.recursiveInit(cache.root, []string{})
-	slog.Info("Import Cache Tree:")
+	slog.Info(fmt.Sprintf("Import Cache Tree (image '%s'):", cache.image))
 	cache.root.Dump(0)
 
 	return cache, nil
@@ -287,14 +289,14 @@ func (cache *ImportCache) createSandboxInNode(node *ImportCacheNode) (err error)
 		codeDir := cache.codeDirs.Make("import-cache")
 		// TODO: clean this up upon failure
 
-		installs, err := cache.pkgPuller.InstallRecursive(node.Packages)
+		installs, err := cache.pkgPuller.InstallRecursive(cache.image, node.Packages)
 		if err != nil {
 			return err
 		}
 
 		topLevelMods := []string{}
 		for _, name := range node.Packages {
-			pkg, err := cache.pkgPuller.GetPkg(name)
+			pkg, err := cache.pkgPuller.GetPkg(cache.image, name)
 			if err != nil {
 				return err
 			}
@@ -308,6 +310,7 @@ func (cache *ImportCache) createSandboxInNode(node *ImportCacheNode) (err error)
 		// Import cache is Python-specific, so always use RT_PYTHON
 		node.meta = &sandbox.SandboxMeta{
 			Runtime:  common.RT_PYTHON,
+			Image:    cache.image,
 			Installs: installs,
 			Imports:  topLevelMods,
 		}
@@ -17,7 +17,7 @@ type MultiTree struct {
 }
 
 // NewMultiTree creates a new MultiTree instance with the specified number of ImportCache trees.
-func NewMultiTree(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPool sandbox.SandboxPool, pp *packages.PackagePuller) (*MultiTree, error) {
+func NewMultiTree(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPool sandbox.SandboxPool, pp *packages.PackagePuller, image string) (*MultiTree, error) {
 	var tree_count int
 	switch cpus := runtime.NumCPU(); {
 	case cpus < 3:
@@ -31,7 +31,7 @@ func NewMultiTree(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPoo
 
 	trees := make([]*ImportCache, tree_count)
 	for i := range trees {
-		tree, err := NewImportCache(codeDirs, scratchDirs, sbPool, pp)
+		tree, err := NewImportCache(codeDirs, scratchDirs, sbPool, pp, image)
 		if err != nil {
 			for j := 0; j < i; j++ {
 				trees[j].Cleanup()
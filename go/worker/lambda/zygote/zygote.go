@@ -3,6 +3,7 @@ package zygote
 import (
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/open-lambda/open-lambda/go/common"
 	"github.com/open-lambda/open-lambda/go/worker/lambda/packages"
@@ -11,13 +12,71 @@ import (
 
 // NewZygoteProvider creates a new ZygoteProvider based on the specified import cache implementation.
 func NewZygoteProvider(codeDirs *common.DirMaker, scratchDirs *common.DirMaker, sbPool sandbox.SandboxPool, pp *packages.PackagePuller) (ZygoteProvider, error) {
+	var newProvider func(image string) (ZygoteProvider, error)
+
 	switch impl := common.Conf.Features.Import_cache; impl {
 	case "tree":
-		return NewImportCache(codeDirs, scratchDirs, sbPool, pp)
+		newProvider = func(image string) (ZygoteProvider, error) {
+			return NewImportCache(codeDirs, scratchDirs, sbPool, pp, image)
+		}
 	case "multitree":
 		slog.Info(fmt.Sprintf("ZygoteProvider %s is very experimental.", impl))
-		return NewMultiTree(codeDirs, scratchDirs, sbPool, pp)
+		newProvider = func(image string) (ZygoteProvider, error) {
+			return NewMultiTree(codeDirs, scratchDirs, sbPool, pp, image)
+		}
 	default:
 		return nil, fmt.Errorf("ZygoteProvider '%s' is not implemented", impl)
 	}
+
+	return newImageZygotes(newProvider)
+}
+
+// imageZygotes keeps a separate ZygoteProvider per base image, as
+// Sandboxes can only be forked from Zygotes with the same root FS.  The
+// provider of the default image is created right away, and the others
+// when first needed.
+type imageZygotes struct {
+	newProvider func(image string) (ZygoteProvider, error)
+
+	mutex     sync.Mutex
+	providers map[string]ZygoteProvider
+}
+
+func newImageZygotes(newProvider func(image string) (ZygoteProvider, error)) (*imageZygotes, error) {
+	defaultProvider, err := newProvider("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageZygotes{
+		newProvider: newProvider,
+		providers:   map[string]ZygoteProvider{"": defaultProvider},
+	}, nil
+}
+
+func (iz *imageZygotes) Create(childSandboxPool sandbox.SandboxPool, isLeaf bool,
+	codeDir, scratchDir string, meta *sandbox.SandboxMeta) (sandbox.Sandbox, error) {
+
+	iz.mutex.Lock()
+	provider, ok := iz.providers[meta.Image]
+	if !ok {
+		var err error
+		if provider, err = iz.newProvider(meta.Image); err != nil {
+			iz.mutex.Unlock()
+			return nil, err
+		}
+		iz.providers[meta.Image] = provider
+	}
+	iz.mutex.Unlock()
+
+	return provider.Create(childSandboxPool, isLeaf, codeDir, scratchDir, meta)
+}
+
+func (iz *imageZygotes) Cleanup() {
+	iz.mutex.Lock()
+	defer iz.mutex.Unlock()
+
+	for _, provider := range iz.providers {
+		provider.Cleanup()
+	}
 }
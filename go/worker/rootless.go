@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// needsRootlessReexec is true if the worker is configured to be rootless
+// but is not yet in its own user namespace (where it would be uid 0).
+func needsRootlessReexec() bool {
+	return common.Conf.Rootless.Enabled && os.Geteuid() != 0
+}
+
+// rootlessSysProcAttr starts a process in new user and mount namespaces,
+// as root mapped to the current user (and group).  Mounts made there are
+// private to the worker, and disappear when it exits.
+func rootlessSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+	}
+}
+
+// runRootless runs this same `ol` command in the namespaces of
+// rootlessSysProcAttr, and waits for it, passing on signals.
+func runRootless() error {
+	binPath, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(binPath, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = rootlessSysProcAttr()
+
+	fmt.Printf("Starting rootless worker in a new user namespace (uid %d is root inside).\n", os.Getuid())
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not create user namespace (are unprivileged user namespaces enabled?): %w", err)
+	}
+
+	// the worker shuts down cleanly on these, so we just wait for it
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	return cmd.Wait()
+}
@@ -53,6 +53,12 @@ type Sandbox interface {
 	// regardless of current state.
 	DestroyIfPaused(reason string)
 
+	// Like Destroy, but the lambda first gets up to shutdown_grace_ms
+	// to clean up (e.g., flush buffers) and exit: the Sandbox asks the
+	// runtime to exit (see SHUTDOWN_PATH) or, failing that, sends
+	// SIGTERM.  Evictions use Destroy, as they need memory now.
+	Shutdown(reason string)
+
 	// Make processes in the container non-schedulable
 	Pause() error
 
@@ -74,6 +80,16 @@ type Sandbox interface {
 	// Represent state as a multi-line string
 	DebugString() string
 
+	// How many processes the kernel has killed in this Sandbox for
+	// exceeding its memory limit.  Sandboxes that can't tell return
+	// an error.
+	OOMKills() (int64, error)
+
+	// Start measuring the resources the Sandbox uses, until stop is
+	// called (e.g., around a request).  Sandboxes that can't measure
+	// their usage return an error.
+	StartUsage() (stop func() (Usage, error), err error)
+
 	// Optional interface for creating processes in children, and
 	// being notified when they die
 	fork(dst Sandbox) error
@@ -87,11 +103,80 @@ type SandboxMeta struct {
 	MemLimitMB int
 	CPUPercent int
 
+	// name of the base image ("" for the worker's default); only
+	// Sandboxes with the same image can fork from each other
+	Image string
+
+	// nil (or mode "host") shares the worker's network; anything else
+	// gets a network namespace of its own
+	Network *common.NetworkPolicy
+
+	// nil means the worker's default profile
+	Seccomp *SeccompProfile
+
+	// worker volumes to mount (see ResolveVolumes)
+	Volumes []VolumeBind
+
+	// if true, the root FS is an overlay with a per-sandbox upper dir
+	// (in the scratch dir), rather than a read-only bind of the base
+	WritableRoot bool
+
+	// RT_CUSTOM only: the lambda's server, and the environment to start
+	// it with (without secrets, which are in SECRETS_ENV_NAME)
+	Custom *common.CustomRuntime
+	Env    map[string]string
+
+	// Sandboxes with lower priorities are evicted first (see
+	// EvictionPolicy)
+	EvictionPriority int
+
+	// common.PRIORITY_BATCH Sandboxes are evicted before others, and
+	// get a smaller share of memory when it is scarce
+	PriorityClass string
+
+	// the lambda the Sandbox runs ("" for zygotes and installers); with
+	// cpu.group_by_lambda, its cgroup is in a group for the lambda
+	Lambda string
+
+	// cpu.weight of the Sandbox, or of its lambda's group (0 means the
+	// kernel's default, 100), and whether it runs on cpu.pinned_cpus
+	CPUWeight int
+	CPUPinned bool
+
+	// if >0, the scratch dir has a quota of this size (see
+	// MountScratchQuota), which the Sandbox releases on Destroy
+	ScratchMB int
+
+	// limits on IO to the disk of Worker_dir (0 means unlimited)
+	IOReadMBps  int
+	IOWriteMBps int
+	IOReadIOPS  int
+	IOWriteIOPS int
+
 	// Python specific fields:
 	Installs []string
 	Imports  []string
 }
 
+// resources used by a Sandbox over some interval (see StartUsage)
+type Usage struct {
+	CPUUsec   int64
+	MemPeakMB int
+}
+
+// name of the file, within a Sandbox's scratch dir, that collects the
+// runtime's stdout/stderr
+const RUNTIME_LOG_NAME = "ol-runtime.log"
+
+// name of the file, within a Sandbox's scratch dir, holding the lambda's
+// resolved secrets (a JSON object of environment variables).  Removed
+// when the Sandbox is destroyed.
+const SECRETS_ENV_NAME = "ol-secrets.json"
+
+// name of the dir, within a Sandbox's scratch dir, holding the upper and
+// work dirs of a writable root (see SandboxMeta.WritableRoot)
+const ROOT_OVERLAY_NAME = "ol-root"
+
 type SandboxError string
 type SandboxDeadError SandboxError
 
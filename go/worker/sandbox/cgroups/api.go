@@ -5,11 +5,15 @@ type Cgroup interface {
 	GetMemUsageMB() int
 	GetMemLimitMB() int
 	SetMemLimitMB(mb int)
+	MemoryEvents() (map[string]int64, error)
 	Pause() error
 	Unpause() error
 	AddPid(pid string) error
 	GetPIDs() ([]string, error)
 	KillAndRelease()
+	StartUsageMeter() (*UsageMeter, error)
+	SetIOMax(device string, max IOMax) error
+	IOStat() (IOStat, error)
 	DebugString() string
 
 	// TODO: find a way to rip this out.  Higher layers should not
@@ -83,26 +83,30 @@ func (cg *CgroupImpl) GroupPath() string {
 	return fmt.Sprintf("%s/%s", cg.pool.poolPath, cg.name)
 }
 
-func (cg *CgroupImpl) MemoryEvents() map[string]int64 {
+// MemoryEvents returns the counters in memory.events (e.g., oom_kill)
+func (cg *CgroupImpl) MemoryEvents() (map[string]int64, error) {
 	result := map[string]int64{}
 	groupPath := cg.ResourcePath("memory.events")
 	f, err := os.Open(groupPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	defer f.Close()
 
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		entries := strings.Split(scanner.Text(), " ")
-		key := entries[0]
+		if len(entries) != 2 {
+			return nil, fmt.Errorf("unexpected line in %s: %q", groupPath, scanner.Text())
+		}
 		value, err := strconv.ParseInt(entries[1], 10, 64)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		result[key] = value
+		result[entries[0]] = value
 	}
 
-	return result
+	return result, scanner.Err()
 }
 
 // ResourcePath returns the path to a specific resource in this cgroup
@@ -315,6 +319,15 @@ func (cg *CgroupImpl) SetCPUPercent(percent int) {
 	cg.WriteString("cpu.max", fmt.Sprintf("%d %d", quota, period))
 }
 
+// SetCPUWeight sets the share of CPU time of the cgroup relative to its
+// siblings (0 means the default, 100)
+func (cg *CgroupImpl) SetCPUWeight(weight int) {
+	if weight == 0 {
+		weight = 100
+	}
+	cg.WriteInt("cpu.weight", int64(weight))
+}
+
 // Pause freezes processes in the cgroup.
 func (cg *CgroupImpl) Pause() error {
 	return cg.setFreezeState(1)
@@ -0,0 +1,118 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// IOMax limits the IO of a cgroup to one device (0 means unlimited)
+type IOMax struct {
+	ReadBps   int64
+	WriteBps  int64
+	ReadIOPS  int64
+	WriteIOPS int64
+}
+
+// IOStat counts the IO of a cgroup, over all devices
+type IOStat struct {
+	ReadBytes  int64
+	WriteBytes int64
+	ReadOps    int64
+	WriteOps   int64
+}
+
+// Sub returns the IO since an earlier stat of the same cgroup
+func (s IOStat) Sub(earlier IOStat) IOStat {
+	return IOStat{
+		ReadBytes:  s.ReadBytes - earlier.ReadBytes,
+		WriteBytes: s.WriteBytes - earlier.WriteBytes,
+		ReadOps:    s.ReadOps - earlier.ReadOps,
+		WriteOps:   s.WriteOps - earlier.WriteOps,
+	}
+}
+
+func (s IOStat) String() string {
+	return fmt.Sprintf("read %d MB (%d ops), wrote %d MB (%d ops)",
+		s.ReadBytes/(1024*1024), s.ReadOps, s.WriteBytes/(1024*1024), s.WriteOps)
+}
+
+// BlockDevice returns the device ("MAJOR:MINOR", as io.max expects) of
+// the disk holding path.  For a partition, that is the whole disk, as
+// io.max only takes disks.
+func BlockDevice(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	sysPath, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev)))
+	if err != nil {
+		return "", fmt.Errorf("%s is not on a block device (e.g., it is on tmpfs or overlayfs)", path)
+	}
+	if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+		sysPath = filepath.Dir(sysPath)
+	}
+
+	dev, err := os.ReadFile(filepath.Join(sysPath, "dev"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(dev)), nil
+}
+
+// SetIOMax limits the IO of the cgroup to device (removing any earlier
+// limits there, if all of max is 0)
+func (cg *CgroupImpl) SetIOMax(device string, max IOMax) error {
+	val := func(x int64) string {
+		if x == 0 {
+			return "max"
+		}
+		return strconv.FormatInt(x, 10)
+	}
+	line := fmt.Sprintf("%s rbps=%s wbps=%s riops=%s wiops=%s",
+		device, val(max.ReadBps), val(max.WriteBps), val(max.ReadIOPS), val(max.WriteIOPS))
+	return cg.TryWriteString("io.max", line)
+}
+
+// IOStat sums the lines of io.stat (one per device)
+func (cg *CgroupImpl) IOStat() (IOStat, error) {
+	var stat IOStat
+	data, err := os.ReadFile(cg.ResourcePath("io.stat"))
+	if err != nil {
+		return stat, err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// fields[0] is the device
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				return stat, fmt.Errorf("malformed io.stat line: %s", line)
+			}
+			val, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return stat, fmt.Errorf("malformed io.stat line: %s", line)
+			}
+			switch key {
+			case "rbytes":
+				stat.ReadBytes += val
+			case "wbytes":
+				stat.WriteBytes += val
+			case "rios":
+				stat.ReadOps += val
+			case "wios":
+				stat.WriteOps += val
+			}
+		}
+	}
+	return stat, nil
+}
@@ -1,12 +1,15 @@
 package cgroups
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/open-lambda/open-lambda/go/common"
@@ -16,6 +19,10 @@ import (
 // If there are more than 2*CGROUP_RESERVE available, they'll be released.
 const CGROUP_RESERVE = 16
 
+// the reserve of each group (see CgroupPool.Group), which only serves
+// the sandboxes of one lambda
+const CGROUP_GROUP_RESERVE = 2
+
 type CgroupPool struct {
 	Name     string
 	poolPath string
@@ -23,6 +30,16 @@ type CgroupPool struct {
 	recycled chan *CgroupImpl
 	quit     chan chan bool
 	nextID   int
+
+	// cpuset.cpus for every cgroup from GetCg ("" leaves them alone)
+	cpus string
+
+	// sub-pools in child cgroups of poolPath, by name
+	groupsMutex sync.Mutex
+	groups      map[string]*CgroupPool
+	// current settings of this pool's own cgroup, if it is a group
+	groupWeight int
+	groupCPUs   string
 }
 
 // InitPoolRoot creates the cgroup pool root directory and enables controllers.
@@ -53,23 +70,156 @@ func InitPoolRoot(poolPath string) error {
 	return nil
 }
 
+// InitDelegatedPoolRoot creates the pool root of a rootless worker, in a
+// cgroup subtree delegated to the worker's user.  A cgroup that contains
+// processes cannot enable controllers for its children, so every process
+// in delegateRoot (the worker, and the `ol` that started it) is first
+// moved to a "worker" leaf beside the pool root.
+func InitDelegatedPoolRoot(delegateRoot, poolPath string) error {
+	workerPath := filepath.Join(delegateRoot, "worker")
+	if err := os.MkdirAll(workerPath, 0755); err != nil {
+		return fmt.Errorf("failed to create worker cgroup %s: %w", workerPath, err)
+	}
+
+	procs, err := os.ReadFile(filepath.Join(delegateRoot, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("cannot read processes of %s (is it delegated to this user?): %w", delegateRoot, err)
+	}
+	for _, pid := range strings.Fields(string(procs)) {
+		err := os.WriteFile(filepath.Join(workerPath, "cgroup.procs"), []byte(pid), os.ModeAppend)
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to move pid %s to %s: %w", pid, workerPath, err)
+		}
+	}
+
+	if err := enableDelegatedControllers(delegateRoot); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(poolPath, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup pool root %s: %w", poolPath, err)
+	}
+	return enableDelegatedControllers(poolPath)
+}
+
+// enableDelegatedControllers enables the controllers sandboxes need for
+// the children of a cgroup.  io is optional, as systemd does not delegate
+// it to users by default.
+func enableDelegatedControllers(cgPath string) error {
+	data, err := os.ReadFile(filepath.Join(cgPath, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(string(data))
+
+	ctrlPath := filepath.Join(cgPath, "cgroup.subtree_control")
+	for _, ctrl := range []string{"pids", "io", "memory", "cpu"} {
+		if !slices.Contains(available, ctrl) {
+			if ctrl == "io" {
+				continue
+			}
+			return fmt.Errorf("the %s controller is not delegated to %s", ctrl, cgPath)
+		}
+		if err := os.WriteFile(ctrlPath, []byte("+"+ctrl), os.ModeAppend); err != nil {
+			return fmt.Errorf("failed to enable %s controller at %s: %w", ctrl, ctrlPath, err)
+		}
+	}
+	return nil
+}
+
 func NewCgroupPool(name string, poolPath string) (*CgroupPool, error) {
+	if st, err := os.Stat(poolPath); err != nil || !st.IsDir() {
+		return nil, fmt.Errorf("cgroup pool root %s does not exist.", poolPath)
+	}
+
+	pool := newCgroupPool(name, poolPath, CGROUP_RESERVE)
+	pool.printf("reusing pool root %s", poolPath)
+	return pool, nil
+}
+
+func newCgroupPool(name string, poolPath string, reserve int) *CgroupPool {
 	pool := &CgroupPool{
 		Name:     name,
 		poolPath: poolPath,
-		ready:    make(chan *CgroupImpl, CGROUP_RESERVE),
-		recycled: make(chan *CgroupImpl, CGROUP_RESERVE),
+		ready:    make(chan *CgroupImpl, reserve),
+		recycled: make(chan *CgroupImpl, reserve),
 		quit:     make(chan chan bool),
 		nextID:   0,
+		groups:   make(map[string]*CgroupPool),
 	}
 
-	if st, err := os.Stat(poolPath); err != nil || !st.IsDir() {
-		return nil, fmt.Errorf("cgroup pool root %s does not exist.", poolPath)
+	go pool.cgTask()
+	return pool
+}
+
+// EnableCpuset lets the cgroups under the pool root be restricted to
+// some CPUs (see SetCPUs and Group)
+func (pool *CgroupPool) EnableCpuset() error {
+	// the parent must offer cpuset to the pool root before the pool
+	// root can offer it to its children
+	for _, cgPath := range []string{filepath.Dir(pool.poolPath), pool.poolPath} {
+		ctrlPath := filepath.Join(cgPath, "cgroup.subtree_control")
+		if err := os.WriteFile(ctrlPath, []byte("+cpuset"), os.ModeAppend); err != nil {
+			return fmt.Errorf("failed to enable cpuset controller at %s: %w", ctrlPath, err)
+		}
 	}
+	return nil
+}
 
-	pool.printf("reusing pool root %s", poolPath)
-	go pool.cgTask()
-	return pool, nil
+// SetCPUs restricts the cgroups of this pool (but not of its groups) to
+// cpus, from the next GetCg on
+func (pool *CgroupPool) SetCPUs(cpus string) {
+	pool.cpus = cpus
+}
+
+// EffectiveCPUs returns the CPUs available to the pool root
+func (pool *CgroupPool) EffectiveCPUs() ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(pool.poolPath, "cpuset.cpus.effective"))
+	if err != nil {
+		return nil, err
+	}
+	return common.ParseCPUList(string(data))
+}
+
+// Group returns the pool of cgroups in the child cgroup of the given
+// name (which is created if needed), so that the cpu.weight of the
+// group (0 means the default, 100) is shared by all of them.  If cpus is
+// not "", the group is restricted to those CPUs (see EnableCpuset).
+func (pool *CgroupPool) Group(name string, weight int, cpus string) (*CgroupPool, error) {
+	pool.groupsMutex.Lock()
+	defer pool.groupsMutex.Unlock()
+
+	group, ok := pool.groups[name]
+	if !ok {
+		groupPath := filepath.Join(pool.poolPath, name)
+		if err := os.Mkdir(groupPath, 0700); err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create cgroup group %s: %w", groupPath, err)
+		}
+		if err := enableDelegatedControllers(groupPath); err != nil {
+			return nil, err
+		}
+		group = newCgroupPool(pool.Name+"/"+name, groupPath, CGROUP_GROUP_RESERVE)
+		pool.groups[name] = group
+	}
+
+	// a lambda's config (and so its group's settings) may change
+	if weight == 0 {
+		weight = 100
+	}
+	if weight != group.groupWeight {
+		path := filepath.Join(group.poolPath, "cpu.weight")
+		if err := os.WriteFile(path, []byte(strconv.Itoa(weight)), os.ModeAppend); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		group.groupWeight = weight
+	}
+	if cpus != group.groupCPUs {
+		path := filepath.Join(group.poolPath, "cpuset.cpus")
+		if err := os.WriteFile(path, []byte(cpus), os.ModeAppend); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		group.groupCPUs = cpus
+	}
+	return group, nil
 }
 
 // NewCgroup creates a new CGroup in the pool
@@ -158,6 +308,16 @@ Empty:
 
 // Destroy drains all child cgroups but preserves the pool root.
 func (pool *CgroupPool) Destroy() {
+	pool.groupsMutex.Lock()
+	for _, group := range pool.groups {
+		group.Destroy()
+		if err := syscall.Rmdir(group.poolPath); err != nil {
+			pool.printf("could not remove group %s: %v", group.poolPath, err)
+		}
+	}
+	pool.groups = make(map[string]*CgroupPool)
+	pool.groupsMutex.Unlock()
+
 	// signal cgTask, then wait for it to finish
 	ch := make(chan bool)
 	pool.quit <- ch
@@ -166,11 +326,16 @@ func (pool *CgroupPool) Destroy() {
 	pool.printf("destroyed all child cgroups, pool root preserved")
 }
 
-// GetCg retrieves a cgroup from the pool, setting its memory limit and CPU percentage.
-func (pool *CgroupPool) GetCg(memLimitMB int, moveMemCharge bool, cpuPercent int) Cgroup {
+// GetCg retrieves a cgroup from the pool, setting its memory limit and CPU
+// percentage and weight.
+func (pool *CgroupPool) GetCg(memLimitMB int, moveMemCharge bool, cpuPercent int, cpuWeight int) Cgroup {
 	cg := <-pool.ready
 	cg.SetMemLimitMB(memLimitMB)
 	cg.SetCPUPercent(cpuPercent)
+	cg.SetCPUWeight(cpuWeight)
+	if pool.cpus != "" {
+		cg.WriteString("cpuset.cpus", pool.cpus)
+	}
 
 	// FIXME not supported in CG2?
 	var _ = moveMemCharge
@@ -0,0 +1,68 @@
+package cgroups
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UsageMeter measures the CPU time and peak memory of the processes in
+// a cgroup between StartUsageMeter and Stop.
+type UsageMeter struct {
+	cg        *CgroupImpl
+	startUsec int64
+
+	// memory.peak, kept open because a reset (kernel 6.12+) only
+	// applies to reads through the same file description
+	peakFile *os.File
+}
+
+// StartUsageMeter starts measuring.  On kernels that can't reset
+// memory.peak, the peak Stop reports is the peak since the cgroup was
+// created (which may include earlier Sandboxes, if cgroups are reused).
+func (cg *CgroupImpl) StartUsageMeter() (*UsageMeter, error) {
+	usec, err := cg.TryReadIntKV("cpu.stat", "usage_usec")
+	if err != nil {
+		return nil, err
+	}
+
+	peakPath := cg.ResourcePath("memory.peak")
+	peakFile, err := os.OpenFile(peakPath, os.O_RDWR, 0)
+	if err == nil {
+		if _, err := peakFile.Write([]byte("reset")); err != nil {
+			cg.printf("cannot reset %s: %v", peakPath, err)
+		}
+	} else if peakFile, err = os.Open(peakPath); err != nil {
+		return nil, err
+	}
+
+	return &UsageMeter{cg: cg, startUsec: usec, peakFile: peakFile}, nil
+}
+
+// Stop returns the CPU time used (in microseconds) and the peak memory
+// (in MB, rounded up) since StartUsageMeter.
+func (m *UsageMeter) Stop() (cpuUsec int64, memPeakMB int, err error) {
+	defer m.peakFile.Close()
+
+	usec, err := m.cg.TryReadIntKV("cpu.stat", "usage_usec")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := m.peakFile.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	raw, err := io.ReadAll(m.peakFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	peak, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad memory.peak %q: %w", raw, err)
+	}
+
+	mb := int64(1024 * 1024)
+	return usec - m.startUsec, int((peak + mb - 1) / mb), nil
+}
@@ -0,0 +1,156 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// how long a custom runtime may take to listen on ol.sock, by default
+const CUSTOM_RUNTIME_READY_TIMEOUT = 10 * time.Second
+
+// startCustomRuntime starts the server from a lambda's ol.yaml in the
+// container.  Unlike the built-in runtimes, the server keeps running in
+// the foreground instead of signaling readiness by exiting, so we start it
+// directly in the container's root and cgroup, then wait until it accepts
+// connections on ol.sock.
+func (container *SOCKContainer) startCustomRuntime(cgProcs *os.File) error {
+	custom := container.meta.Custom
+	if custom == nil || len(custom.Command) == 0 {
+		return fmt.Errorf("custom runtime has no command")
+	}
+
+	env, err := container.customRuntimeEnv()
+	if err != nil {
+		return err
+	}
+
+	// env searches the PATH inside the container for the program
+	cmd := &exec.Cmd{
+		Path: "/usr/bin/env",
+		Args: append([]string{"env"}, custom.Command...),
+		Env:  env,
+		Dir:  "/handler",
+		SysProcAttr: &syscall.SysProcAttr{
+			Chroot:      container.containerRootDir,
+			UseCgroupFD: true,
+			CgroupFD:    int(cgProcs.Fd()),
+			Setsid:      true,
+			// the same namespaces the Python runtime unshares (see
+			// ol.unshare), plus mounts
+			Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID |
+				syscall.CLONE_NEWIPC | syscall.CLONE_NEWNS,
+		},
+	}
+
+	closeLog, err := setRuntimeOutput(cmd, container.scratchDir)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if container.net != nil {
+		err = container.net.startIn(cmd)
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		return fmt.Errorf("could not start custom runtime %v: %v", custom.Command, err)
+	}
+
+	container.customPid = cmd.Process.Pid
+
+	// the process is killed with the rest of the cgroup when the
+	// container is destroyed; this just reaps it
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	timeout := CUSTOM_RUNTIME_READY_TIMEOUT
+	if custom.ReadyTimeoutSec > 0 {
+		timeout = time.Duration(custom.ReadyTimeoutSec) * time.Second
+	}
+	return waitForSocket(filepath.Join(container.scratchDir, "ol.sock"), timeout, exited)
+}
+
+// customRuntimeEnv is the environment for a custom runtime: the lambda's
+// environment variables, with secrets resolved
+func (container *SOCKContainer) customRuntimeEnv() ([]string, error) {
+	vars := map[string]string{
+		"PATH":      "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME":      "/tmp",
+		"OL_SOCKET": "/host/ol.sock",
+	}
+	for k, v := range container.meta.Env {
+		vars[k] = v
+	}
+
+	data, err := os.ReadFile(filepath.Join(container.scratchDir, SECRETS_ENV_NAME))
+	if err == nil {
+		secrets := make(map[string]string)
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return nil, err
+		}
+		for k, v := range secrets {
+			vars[k] = v
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// catchesSignal reports whether process pid has a handler for sig
+// (according to the SigCgt mask in /proc/<pid>/status)
+func catchesSignal(pid int, sig syscall.Signal) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if mask, ok := strings.CutPrefix(line, "SigCgt:"); ok {
+			caught, err := strconv.ParseUint(strings.TrimSpace(mask), 16, 64)
+			return err == nil && caught&(1<<(uint(sig)-1)) != 0
+		}
+	}
+	return false
+}
+
+// waitForSocket polls until a server accepts connections on sockPath,
+// failing early if the server exits
+func waitForSocket(sockPath string, timeout time.Duration, exited chan error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("custom runtime exited before listening on ol.sock (%v); see %s", err, RUNTIME_LOG_NAME)
+		default:
+		}
+
+		conn, err := net.Dial("unix", sockPath)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("custom runtime did not listen on ol.sock within %v: %v", timeout, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -174,6 +174,18 @@ func (container *DockerContainer) Destroy(_ string) {
 	}
 }
 
+// Shutdown gives the runtime a chance to run the lambda's hook (there
+// is no SIGTERM fallback, as internalDestroy expects a running container)
+func (container *DockerContainer) Shutdown(reason string) {
+	if grace := shutdownGrace(); grace > 0 {
+		if err := container.Unpause(); err == nil {
+			requestShutdown(container.httpClient, time.Now().Add(grace))
+		}
+	}
+
+	container.Destroy(reason)
+}
+
 func (container *DockerContainer) DestroyIfPaused(reason string) {
 	container.Destroy(reason) // we're allowed to implement this by uncondationally destroying
 }
@@ -197,6 +209,9 @@ func (container *DockerContainer) internalDestroy() error {
 	if err := os.RemoveAll(filepath.Join(container.hostDir, "fs.sock")); err != nil {
 		return err
 	}
+	if err := os.RemoveAll(filepath.Join(container.hostDir, SECRETS_ENV_NAME)); err != nil {
+		return err
+	}
 
 	if err := container.client.RemoveContainer(docker.RemoveContainerOptions{
 		ID: container.container.ID,
@@ -205,6 +220,12 @@ func (container *DockerContainer) internalDestroy() error {
 		return container.dockerError(err)
 	}
 
+	if container.meta.ScratchMB > 0 {
+		if err := ReleaseScratchQuota(container.hostDir); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -242,6 +263,14 @@ func (*DockerContainer) GetProxyLog() string {
 	return "" // TODO
 }
 
+func (*DockerContainer) OOMKills() (int64, error) {
+	return 0, fmt.Errorf("OOM kills not tracked for docker Sandboxes")
+}
+
+func (*DockerContainer) StartUsage() (func() (Usage, error), error) {
+	return nil, fmt.Errorf("usage metering not supported for docker Sandboxes")
+}
+
 // NSPid returns the pid of the first process of the docker container.
 func (container *DockerContainer) NSPid() string {
 	return container.nspid
@@ -287,7 +316,7 @@ func (container *DockerContainer) runServer() error {
 }
 
 func (container *DockerContainer) DebugString() string {
-	return fmt.Sprintf("SANDBOX %s (DOCKER)\n", container.ID())
+	return fmt.Sprintf("SANDBOX %s (DOCKER)\n", container.ID()) + scratchDebugString(container.hostDir, container.meta)
 }
 
 func (*DockerContainer) fork(_ Sandbox) (err error) {
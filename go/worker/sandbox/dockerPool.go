@@ -22,7 +22,6 @@ type DockerPool struct {
 	labels        map[string]string
 	caps          []string
 	pidMode       string
-	pkgsDir       string
 	idxPtr        *int64
 	dockerRuntime string
 	eventHandlers []SandboxEventFunc
@@ -36,6 +35,10 @@ func NewDockerPool(pidMode string, caps []string) (*DockerPool, error) {
 		return nil, err
 	}
 
+	if err := prepareVolumes(); err != nil {
+		return nil, err
+	}
+
 	var sharedIdx int64 = -1
 	idxPtr := &sharedIdx
 
@@ -48,7 +51,6 @@ func NewDockerPool(pidMode string, caps []string) (*DockerPool, error) {
 		labels:        labels,
 		caps:          caps,
 		pidMode:       pidMode,
-		pkgsDir:       common.Conf.Pkgs_dir,
 		idxPtr:        idxPtr,
 		dockerRuntime: common.Conf.Docker.Runtime,
 		eventHandlers: []SandboxEventFunc{},
@@ -71,17 +73,34 @@ func (pool *DockerPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir
 		panic("Non-leaves not supported for DockerPool")
 	}
 
+	if meta.hasIOLimits() {
+		return nil, fmt.Errorf("the docker sandbox does not support IO limits")
+	}
+
 	id := fmt.Sprintf("%d", atomic.AddInt64(pool.idxPtr, 1))
 
+	img, err := common.Conf.Image(meta.Image)
+	if err != nil {
+		return nil, err
+	}
+
 	volumes := []string{
 		fmt.Sprintf("%s:%s", scratchDir, "/host"),
-		fmt.Sprintf("%s:%s:ro", pool.pkgsDir, "/packages"),
+		fmt.Sprintf("%s:%s:ro", img.Pkgs_dir, "/packages"),
 	}
 
 	if codeDir != "" {
 		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", codeDir, "/handler"))
 	}
 
+	for _, vol := range meta.Volumes {
+		if vol.ReadOnly {
+			volumes = append(volumes, fmt.Sprintf("%s:%s:ro", vol.HostPath, vol.Target))
+		} else {
+			volumes = append(volumes, fmt.Sprintf("%s:%s", vol.HostPath, vol.Target))
+		}
+	}
+
 	// pipe for synchronization before socket is ready
 	pipe := filepath.Join(scratchDir, "server_pipe")
 	_, statErr := os.Stat(pipe)
@@ -105,15 +124,46 @@ func (pool *DockerPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir
 		pkgDirs = append(pkgDirs, "/packages/"+pkg+"/files")
 	}
 
+	// Docker's "none" network has only a loopback interface
+	networkMode := ""
+	if meta.Network.Isolated() {
+		if meta.Network.Mode == common.NET_EGRESS {
+			return nil, fmt.Errorf("network mode '%s' is not supported by the docker sandbox", common.NET_EGRESS)
+		}
+		networkMode = "none"
+	}
+
+	var securityOpts []string
+	if meta.Seccomp != nil {
+		opt, err := meta.Seccomp.dockerSecurityOpt()
+		if err != nil {
+			return nil, err
+		}
+		if opt != "" {
+			securityOpts = append(securityOpts, opt)
+		}
+	}
+
+	// the scratch quota covers /host; /tmp gets a tmpfs of the same size
+	tmpfs := map[string]string{}
+	if meta.ScratchMB > 0 {
+		tmpfs["/tmp"] = fmt.Sprintf("size=%dm", meta.ScratchMB)
+	}
+
 	// create the container using the specified configuration
 	procLimit := int64(common.Conf.Limits.Procs)
 	swappiness := int64(common.Conf.Limits.Swappiness)
 	cpuPercent := int64(common.Conf.Limits.CPU_percent)
+	var cpuShares int64 // docker's default
+	if meta.CPUWeight > 0 {
+		// docker converts shares (default 1024) back to a cgroup v2 weight
+		cpuShares = int64(meta.CPUWeight) * 1024 / 100
+	}
 	container, err := pool.client.CreateContainer(
 		docker.CreateContainerOptions{
 			Config: &docker.Config{
 				Cmd:    []string{"/spin"},
-				Image:  common.Conf.Docker.Base_image,
+				Image:  img.Docker_image,
 				Labels: pool.labels,
 				Env:    []string{"PYTHONPATH=" + strings.Join(pkgDirs, ":")},
 			},
@@ -125,7 +175,11 @@ func (pool *DockerPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir
 				PidsLimit:        &procLimit,
 				MemorySwappiness: &swappiness,
 				CPUPercent:       cpuPercent,
+				CPUShares:        cpuShares,
 				Memory:           int64(meta.MemLimitMB * 1024 * 1024),
+				NetworkMode:      networkMode,
+				SecurityOpt:      securityOpts,
+				Tmpfs:            tmpfs,
 			},
 		},
 	)
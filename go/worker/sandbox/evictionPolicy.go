@@ -0,0 +1,118 @@
+package sandbox
+
+import (
+	"fmt"
+	"time"
+)
+
+// EvictionPolicy decides which of the Sandboxes the SOCKEvictor may
+// evict (e.g., the paused ones without children) goes first.  It is fed
+// the same SandboxEvents as the evictor, from the evictor's goroutine, so
+// implementations need no locking.
+//
+// Per-lambda eviction priorities (from ol.yaml) take precedence over the
+// policy, which only orders Sandboxes of equal priority.
+type EvictionPolicy interface {
+	Event(evType SandboxEventType, sb Sandbox)
+
+	// Sandboxes with lower scores are evicted first
+	Score(sb Sandbox) float64
+}
+
+// NewEvictionPolicy creates the policy of the given name ("" means lru)
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "", "lru":
+		return newLRUPolicy(), nil
+	case "lfu":
+		return &lfuPolicy{lru: newLRUPolicy(), uses: make(map[string]int)}, nil
+	case "cost":
+		return &costPolicy{lru: newLRUPolicy()}, nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy '%s'", name)
+}
+
+// lruPolicy evicts the Sandbox that has been idle the longest.  A
+// Sandbox is paused when it finishes serving, so the last pause (or
+// unpause, if it is running) is its last use.
+type lruPolicy struct {
+	lastUsed map[string]time.Time
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{lastUsed: make(map[string]time.Time)}
+}
+
+func (p *lruPolicy) Event(evType SandboxEventType, sb Sandbox) {
+	switch evType {
+	case EvCreate, EvPause, EvUnpause:
+		p.lastUsed[sb.ID()] = time.Now()
+	case EvDestroy:
+		delete(p.lastUsed, sb.ID())
+	}
+}
+
+func (p *lruPolicy) Score(sb Sandbox) float64 {
+	return float64(p.lastUsed[sb.ID()].UnixNano())
+}
+
+// rank is like Score, but scaled to [0, 1), so that other policies can
+// use it to break ties
+func (p *lruPolicy) rank(sb Sandbox) float64 {
+	lastUsed, ok := p.lastUsed[sb.ID()]
+	if !ok {
+		return 0
+	}
+	// idle for a day or more is as good as idle forever
+	idle := time.Since(lastUsed)
+	if idle >= 24*time.Hour {
+		return 0
+	}
+	return 1 - float64(idle)/float64(24*time.Hour)
+}
+
+// lfuPolicy evicts the Sandbox that has been used (unpaused) the fewest
+// times, and the least recently used among those
+type lfuPolicy struct {
+	lru  *lruPolicy
+	uses map[string]int
+}
+
+func (p *lfuPolicy) Event(evType SandboxEventType, sb Sandbox) {
+	p.lru.Event(evType, sb)
+	switch evType {
+	case EvCreate, EvUnpause:
+		p.uses[sb.ID()] += 1
+	case EvDestroy:
+		delete(p.uses, sb.ID())
+	}
+}
+
+func (p *lfuPolicy) Score(sb Sandbox) float64 {
+	// a use outweighs any difference in recency
+	return float64(p.uses[sb.ID()]) + p.lru.rank(sb)
+}
+
+// costPolicy evicts the Sandbox that is cheapest to bring back for the
+// memory it frees: the time it took to create, per MB of its memory
+// limit (which is what it holds in the MemPool).  Recency adds less than
+// one to the score, so it mostly just breaks ties.
+type costPolicy struct {
+	lru *lruPolicy
+}
+
+func (p *costPolicy) Event(evType SandboxEventType, sb Sandbox) {
+	p.lru.Event(evType, sb)
+}
+
+func (p *costPolicy) Score(sb Sandbox) float64 {
+	ms := 0.0
+	if safe, ok := sb.(*safeSandbox); ok {
+		ms = float64(safe.createLatency) / float64(time.Millisecond)
+	}
+	memMB := sb.Meta().MemLimitMB
+	if memMB <= 0 {
+		memMB = 1
+	}
+	return ms/float64(memMB) + p.lru.rank(sb)
+}
@@ -13,9 +13,12 @@ import (
 // evictor can only run if there's enough memory for two containers.
 // if there are only 2, our goal is to have free mem for on container.
 // 20% only applies to containers in excess of 2.
+//
+// evictor.free_percent in the worker config overrides this.
 const FREE_SANDBOXES_PERCENT_GOAL = 20
 
-// the maximum number of evictions we'll do concurrently
+// the maximum number of evictions we'll do concurrently (unless
+// evictor.concurrent is set)
 const CONCURRENT_EVICTIONS = 8
 
 type SOCKEvictor struct {
@@ -43,6 +46,15 @@ type SOCKEvictor struct {
 
 	// Sandbox ID => List/Element position in a state queue
 	stateMap map[string]*ListLocation
+
+	// which Sandbox in a queue to evict first
+	policy EvictionPolicy
+
+	freePercentGoal int
+	maxEvicting     int
+
+	// set when the MemPool reports pressure, until doEvictions acts
+	pressured bool
 }
 
 type ListLocation struct {
@@ -50,7 +62,12 @@ type ListLocation struct {
 	*list.Element
 }
 
-func NewSOCKEvictor(sbPool *SOCKPool) *SOCKEvictor {
+func NewSOCKEvictor(sbPool *SOCKPool) (*SOCKEvictor, error) {
+	policy, err := NewEvictionPolicy(common.Conf.Evictor.Policy)
+	if err != nil {
+		return nil, err
+	}
+
 	// level 0: no children, paused
 	// level 1: no children, unpaused
 	// level 2: children
@@ -66,12 +83,22 @@ func NewSOCKEvictor(sbPool *SOCKPool) *SOCKEvictor {
 		prioQueues: prioQueues,
 		evicting:   list.New(),
 		stateMap:   make(map[string]*ListLocation),
+		policy:     policy,
+
+		freePercentGoal: FREE_SANDBOXES_PERCENT_GOAL,
+		maxEvicting:     CONCURRENT_EVICTIONS,
+	}
+	if common.Conf.Evictor.Free_percent > 0 {
+		e.freePercentGoal = common.Conf.Evictor.Free_percent
+	}
+	if common.Conf.Evictor.Concurrent > 0 {
+		e.maxEvicting = common.Conf.Evictor.Concurrent
 	}
 
 	sbPool.AddListener(e.Event)
 	go e.Run()
 
-	return e
+	return e, nil
 }
 
 func (evictor *SOCKEvictor) Event(evType SandboxEventType, sb Sandbox) {
@@ -96,10 +123,17 @@ func (evictor *SOCKEvictor) move(sb Sandbox, target *list.List) {
 	}
 }
 
+// a nil event while blocking means the MemPool is under pressure
+// (overcommit only), which doEvictions should act on
 func (evictor *SOCKEvictor) nextEvent(block bool) *SandboxEvent {
 	if block {
-		event := <-evictor.events
-		return &event
+		select {
+		case event := <-evictor.events:
+			return &event
+		case <-evictor.mem.pressureEvents:
+			evictor.pressured = true
+			return nil
+		}
 	}
 
 	select {
@@ -152,9 +186,10 @@ func (evictor *SOCKEvictor) updateState() {
 		evictor.printf("Evictor: Sandbox %v priority goes to %d", sb.ID(), prio)
 		if prio < 0 {
 			panic(fmt.Sprintf("priority should never go negative, but it went to %d for sandbox %s", prio, sb.ID()))
-			panic("priority should never go negative")
 		}
 
+		evictor.policy.Event(event.EvType, sb)
+
 		if event.EvType == EvDestroy {
 			evictor.move(sb, nil)
 			delete(evictor.priority, sb.ID())
@@ -172,11 +207,32 @@ func (evictor *SOCKEvictor) updateState() {
 	}
 }
 
-// evict whatever SB is at the front of the queue, assumes
-// queue is not empty
-func (evictor *SOCKEvictor) evictFront(queue *list.List, force bool) {
-	front := queue.Front()
-	sb := front.Value.(Sandbox)
+// evictBefore reports whether a should be evicted before b: batch
+// lambdas go first, then lambdas with lower eviction priorities, then
+// the policy decides
+func (evictor *SOCKEvictor) evictBefore(a, b Sandbox) bool {
+	batchA := a.Meta().PriorityClass == common.PRIORITY_BATCH
+	batchB := b.Meta().PriorityClass == common.PRIORITY_BATCH
+	if batchA != batchB {
+		return batchA
+	}
+
+	prioA, prioB := a.Meta().EvictionPriority, b.Meta().EvictionPriority
+	if prioA != prioB {
+		return prioA < prioB
+	}
+	return evictor.policy.Score(a) < evictor.policy.Score(b)
+}
+
+// evict the SB in the queue that should go first, assumes queue is
+// not empty
+func (evictor *SOCKEvictor) evictNext(queue *list.List, force bool) {
+	var sb Sandbox
+	for e := queue.Front(); e != nil; e = e.Next() {
+		if candidate := e.Value.(Sandbox); sb == nil || evictor.evictBefore(candidate, sb) {
+			sb = candidate
+		}
+	}
 
 	evictor.printf("Evict Sandbox %v", sb.ID())
 	evictor.move(sb, evictor.evicting)
@@ -203,7 +259,7 @@ func (evictor *SOCKEvictor) doEvictions() {
 
 	// how many sandboxes would we like to be able to spin up,
 	// without waiting for more memory?
-	freeGoal := 1 + ((evictor.mem.totalMB/memLimitMB)-2)*FREE_SANDBOXES_PERCENT_GOAL/100
+	freeGoal := 1 + ((evictor.mem.capacityMB/memLimitMB)-2)*evictor.freePercentGoal/100
 
 	// how many shoud we try to evict?
 	//
@@ -212,14 +268,24 @@ func (evictor *SOCKEvictor) doEvictions() {
 	// states with reduced memory limits
 	evictCount := freeGoal - freeSandboxes
 
-	evictCap := CONCURRENT_EVICTIONS - evictor.evicting.Len()
+	// under pressure, start evicting before we're out of memory
+	if evictor.pressured {
+		evictor.pressured = false
+		if evictCount < 1 {
+			evictor.printf("memory pressure, so evicting early")
+			evictCount = 1
+		}
+	}
+
+	evictCap := evictor.maxEvicting - evictor.evicting.Len()
 	if evictCap < evictCount {
 		evictCount = evictCap
 	}
 
 	// try evicting the desired number, starting with the paused queue
+	// (the policy picks which paused Sandboxes go first)
 	for evictCount > 0 && evictor.prioQueues[0].Len() > 0 {
-		evictor.evictFront(evictor.prioQueues[0], false)
+		evictor.evictNext(evictor.prioQueues[0], false)
 		evictCount -= 1
 	}
 
@@ -232,7 +298,7 @@ func (evictor *SOCKEvictor) doEvictions() {
 	if freeSandboxes <= 0 && evictor.evicting.Len() == 0 {
 		evictor.printf("WARNING!  Critically low on memory, so evicting an active Sandbox")
 		if evictor.prioQueues[1].Len() > 0 {
-			evictor.evictFront(evictor.prioQueues[1], true)
+			evictor.evictNext(evictor.prioQueues[1], true)
 		}
 	}
 
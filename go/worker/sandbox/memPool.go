@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/open-lambda/open-lambda/go/common"
 )
@@ -15,6 +16,16 @@ type MemPool struct {
 	// how much memory is being managed (includes free and allocated)
 	totalMB int
 
+	// how much can be handed out; more than totalMB with overcommit
+	capacityMB int
+
+	// overcommit only (nil otherwise): what the sandboxes really use
+	usage *memUsage
+
+	// signaled (without blocking) when the evictor should free memory
+	// before it runs out (overcommit only)
+	pressureEvents chan struct{}
+
 	// a task listens on this, with requests to decrement memory
 	// (which may block) or increment it
 	memRequests chan *memReq
@@ -22,12 +33,24 @@ type MemPool struct {
 	// decrement requests read from memRequests that need to wait
 	// for memory sit here until it's available
 	memRequestsWaiting *list.List
+
+	// weighted fair queuing of waiting requests (memTask only): the
+	// finish tag of the last request served, and of the last request
+	// of each lambda
+	virtualTime float64
+	lastFinish  map[string]float64
 }
 
 type memReq struct {
 	// how much we're requesting
 	mb int
 
+	// for decrements: the lambda asking ("" for other Sandboxes), the
+	// weight of its priority class, and its place in the fair queue
+	lambda string
+	weight int
+	finish float64
+
 	// any response means the memory is allocated; the particular
 	// number indicates the total remaining memory available in
 	// the pool
@@ -38,8 +61,17 @@ func NewMemPool(name string, totalMB int) *MemPool {
 	pool := &MemPool{
 		name:               name,
 		totalMB:            totalMB,
+		capacityMB:         totalMB,
 		memRequests:        make(chan *memReq, 32),
 		memRequestsWaiting: list.New(),
+		lastFinish:         make(map[string]float64),
+	}
+
+	if common.Conf.Mem_overcommit.Enabled {
+		pool.capacityMB = common.Conf.Mem_overcommit.CapacityMB(totalMB)
+		pool.usage = newMemUsage(totalMB)
+		pool.pressureEvents = make(chan struct{}, 1)
+		pool.printf("overcommit: limits up to %d MB, admitting below %d MB used", pool.capacityMB, pool.usage.admitMB)
 	}
 
 	go pool.memTask()
@@ -58,41 +90,92 @@ func (pool *MemPool) printf(format string, args ...any) {
 // system, adding to the count when memory is released, and blocking
 // requesters until enough is free
 func (pool *MemPool) memTask() {
-	availableMB := pool.totalMB
+	availableMB := pool.capacityMB
+
+	// with overcommit, we also watch actual usage
+	var samples <-chan time.Time
+	if pool.usage != nil {
+		ticker := time.NewTicker(pool.usage.interval)
+		defer ticker.Stop()
+		samples = ticker.C
+	}
 
 	for {
-		req, ok := <-pool.memRequests
-		if !ok {
-			return
-		}
+		select {
+		case req, ok := <-pool.memRequests:
+			if !ok {
+				return
+			}
+
+			if pool.capacityMB+req.mb < 0 {
+				panic(fmt.Sprintf("received request for %d MB to pool of total size %d MB",
+					-req.mb, pool.capacityMB))
+			}
 
-		if pool.totalMB+req.mb < 0 {
-			panic(fmt.Sprintf("received request for %d MB to pool of total size %d MB",
-				-req.mb, pool.totalMB))
+			if req.mb >= 0 {
+				availableMB += req.mb
+				pool.printf("%d of %d MB available", availableMB, pool.capacityMB)
+				req.resp <- availableMB
+			} else {
+				pool.enqueue(req)
+			}
+		case <-samples:
+			pool.usage.sample()
+			if pool.usage.pressured(pool.memRequestsWaiting.Len() > 0) {
+				select {
+				case pool.pressureEvents <- struct{}{}:
+				default:
+				}
+			}
 		}
 
-		if req.mb >= 0 {
+		// POLICY: which requests should we serve first?  The one
+		// with the earliest finish tag, so that while memory is
+		// short, lambdas get it in proportion to their weights
+		// (rather than in arrival order, where a flood of requests
+		// from one lambda would keep the others waiting)
+		for e := pool.nextWaiting(); e != nil; e = pool.nextWaiting() {
+			req := e.Value.(*memReq)
+			// req.mb is negative
+			if availableMB+req.mb < 0 || !pool.usage.admits(-req.mb) {
+				break
+			}
+			pool.memRequestsWaiting.Remove(e)
+			pool.virtualTime = req.finish
 			availableMB += req.mb
-			pool.printf("%d of %d MB available", availableMB, pool.totalMB)
+			pool.printf("%d of %d MB available", availableMB, pool.capacityMB)
 			req.resp <- availableMB
-		} else {
-			pool.memRequestsWaiting.PushBack(req)
 		}
 
-		// POLICY: which requests should we serve first?
-		if e := pool.memRequestsWaiting.Front(); e != nil {
-			req = e.Value.(*memReq)
-			// req.mb is negative
-			if availableMB+req.mb >= 0 {
-				pool.memRequestsWaiting.Remove(e)
-				availableMB += req.mb
-				pool.printf("%d of %d MB available", availableMB, pool.totalMB)
-				req.resp <- availableMB
-			}
+		if pool.memRequestsWaiting.Len() == 0 {
+			// nobody is waiting, so nobody is behind
+			pool.virtualTime = 0
+			clear(pool.lastFinish)
 		}
 	}
 }
 
+// enqueue a decrement request, giving it a finish tag after that of the
+// lambda's previous request (self-clocked fair queuing)
+func (pool *MemPool) enqueue(req *memReq) {
+	start := max(pool.virtualTime, pool.lastFinish[req.lambda])
+	req.finish = start + float64(-req.mb)/float64(req.weight)
+	pool.lastFinish[req.lambda] = req.finish
+	pool.memRequestsWaiting.PushBack(req)
+}
+
+// nextWaiting returns the waiting request with the earliest finish tag
+// (the earliest to arrive among equal tags), or nil
+func (pool *MemPool) nextWaiting() *list.Element {
+	var next *list.Element
+	for e := pool.memRequestsWaiting.Front(); e != nil; e = e.Next() {
+		if next == nil || e.Value.(*memReq).finish < next.Value.(*memReq).finish {
+			next = e
+		}
+	}
+	return next
+}
+
 // this adjusts the available memory in the pool up/down, and returns
 // the remaining available after the adjustment.
 //
@@ -104,8 +187,24 @@ func (pool *MemPool) memTask() {
 // available memory).
 func (pool *MemPool) adjustAvailableMB(mb int) (availableMB int) {
 	req := &memReq{
-		mb:   mb,
-		resp: make(chan int),
+		mb:     mb,
+		weight: common.Conf.Priority.Weight(common.PRIORITY_INTERACTIVE),
+		resp:   make(chan int),
+	}
+
+	pool.memRequests <- req
+	return <-req.resp
+}
+
+// acquireMB takes mb from the pool for a new Sandbox, blocking until
+// it is available.  While Sandboxes wait, the pool is shared fairly
+// among lambdas, by the weights of their priority classes.
+func (pool *MemPool) acquireMB(mb int, meta *SandboxMeta) (availableMB int) {
+	req := &memReq{
+		mb:     -mb,
+		lambda: meta.Lambda,
+		weight: common.Conf.Priority.Weight(meta.PriorityClass),
+		resp:   make(chan int),
 	}
 
 	pool.memRequests <- req
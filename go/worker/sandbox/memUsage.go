@@ -0,0 +1,120 @@
+package sandbox
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// memUsage samples the actual memory use and pressure (PSI) of all
+// sandboxes, from the root of the cgroup pool, for a MemPool in
+// overcommit mode.  It is only used by the MemPool's task.
+type memUsage struct {
+	cgPath   string
+	interval time.Duration
+
+	// new sandboxes are admitted while usage is below this
+	admitMB int
+
+	// memory pressure ("some avg10", in percent) that triggers early
+	// eviction
+	pressureAvg10 float64
+
+	// latest samples.  usedMB also includes the limits of sandboxes
+	// admitted since, as they haven't had a chance to allocate yet.
+	usedMB int
+	avg10  float64
+
+	// so we only complain once about missing files
+	warned bool
+}
+
+func newMemUsage(totalMB int) *memUsage {
+	cfg := common.Conf.Mem_overcommit
+	u := &memUsage{
+		cgPath:        common.CgroupPoolPath(filepath.Dir(common.Conf.Worker_dir)),
+		interval:      500 * time.Millisecond,
+		admitMB:       totalMB * 80 / 100,
+		pressureAvg10: 10,
+	}
+	if cfg.Sample_ms > 0 {
+		u.interval = time.Duration(cfg.Sample_ms) * time.Millisecond
+	}
+	if cfg.Admit_percent > 0 {
+		u.admitMB = totalMB * cfg.Admit_percent / 100
+	}
+	if cfg.Pressure_avg10 > 0 {
+		u.pressureAvg10 = cfg.Pressure_avg10
+	}
+	return u
+}
+
+func (u *memUsage) sample() {
+	used, err := readCgroupInt(filepath.Join(u.cgPath, "memory.current"))
+	if err == nil {
+		u.usedMB = int(used / 1024 / 1024)
+	}
+
+	if err == nil {
+		u.avg10, err = readMemPressureAvg10(filepath.Join(u.cgPath, "memory.pressure"))
+	}
+
+	if err != nil && !u.warned {
+		slog.Warn(fmt.Sprintf("memory overcommit cannot sample %s (admitting by limits only): %v", u.cgPath, err))
+		u.warned = true
+	}
+}
+
+// admits reports whether a sandbox with a limit of mb can start now.
+// Without overcommit (nil), the limits alone decide.
+func (u *memUsage) admits(mb int) bool {
+	if u == nil {
+		return true
+	}
+	if u.usedMB >= u.admitMB {
+		return false
+	}
+	u.usedMB += mb
+	return true
+}
+
+// pressured reports whether the evictor should free memory now: the
+// kernel reports memory stalls, or sandboxes are waiting for usage to
+// come down
+func (u *memUsage) pressured(waiting bool) bool {
+	return u.avg10 > u.pressureAvg10 || (waiting && u.usedMB >= u.admitMB)
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readMemPressureAvg10 parses the "some" line of a PSI file, like:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readMemPressureAvg10(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		if avg, ok := strings.CutPrefix(fields[1], "avg10="); ok {
+			return strconv.ParseFloat(avg, 64)
+		}
+	}
+	return 0, fmt.Errorf("no 'some avg10' in %s", path)
+}
@@ -0,0 +1,475 @@
+package sandbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// where `ip netns add` keeps namespaces
+const NETNS_DIR = "/run/netns"
+
+// sandboxNet is the network namespace of one SOCK sandbox.  For "egress"
+// mode, it is connected to the host by a veth pair, and iptables rules on
+// the host (out of reach of the sandbox, which may be root in its own
+// namespace) decide what it can talk to.
+type sandboxNet struct {
+	pool   *netPool
+	nsName string
+
+	// egress only
+	block  int
+	hostIf string
+	chain  string
+	rules  [][]string // host rules to delete on release (iptables args after -I/-D)
+}
+
+// netPool hands out network namespaces and egress addresses for a SOCKPool
+type netPool struct {
+	// namespaces and iptables rules of this worker are named with this
+	// prefix, so that leftovers of a crashed worker can be found
+	prefix string
+	subnet *net.IPNet
+
+	// rejects sandbox connections to the worker (see workerPortRule),
+	// nil if it could not be added
+	portRule []string
+
+	mutex         sync.Mutex
+	usedBlocks    map[int]bool
+	forwardingSet bool
+}
+
+func networkPrefix(workerPort string) string {
+	return fmt.Sprintf("ol-%s-", workerPort)
+}
+
+// newNetPool creates a netPool for the sandboxes in the cgroup pool at
+// poolPath
+func newNetPool(poolPath string) (*netPool, error) {
+	pool := &netPool{
+		prefix:     networkPrefix(common.Conf.Worker_port),
+		usedBlocks: make(map[int]bool),
+	}
+
+	if common.Conf.Network.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(common.Conf.Network.Subnet)
+		if err != nil {
+			return nil, err
+		}
+		pool.subnet = subnet
+	}
+
+	// a previous worker with the same port may have crashed (rootless
+	// workers can't create networks, so they have none to clean up)
+	if common.Conf.Rootless.Enabled {
+		return pool, nil
+	}
+	if errs := CleanupNetworks(common.Conf.Worker_port, common.Conf.Network.Subnet); errs > 0 {
+		slog.Warn(fmt.Sprintf("%d error(s) cleaning up old sandbox networks", errs))
+	}
+
+	pool.portRule = workerPortRule(pool.prefix, poolPath)
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		// SOCKPools share a cgroup root, so another may have added it
+		if exec.Command(cmd, append([]string{"-w", "-C"}, pool.portRule...)...).Run() == nil {
+			continue
+		}
+		if err := runNetCmd(append([]string{cmd, "-w", "-I"}, pool.portRule...)...); err != nil {
+			slog.Error(fmt.Sprintf("sandboxes in '%s' mode can reach the worker's port: %v", common.NET_HOST, err))
+		}
+	}
+
+	return pool, nil
+}
+
+// workerPortRule rejects connections from the sandboxes (any process in
+// the cgroup pool at poolPath) to the worker's port.  Sandboxes in "host"
+// mode share the worker's network, so this is what keeps them from using
+// its registry and admin endpoints.
+func workerPortRule(prefix string, poolPath string) []string {
+	return []string{
+		"OUTPUT", "-p", "tcp", "--dport", common.Conf.Worker_port,
+		"-m", "cgroup", "--path", strings.TrimPrefix(poolPath, "/sys/fs/cgroup"),
+		"-m", "comment", "--comment", prefix + "worker-port",
+		"-j", "REJECT", "--reject-with", "tcp-reset",
+	}
+}
+
+// cleanup deletes the host rules of the netPool
+func (pool *netPool) cleanup() {
+	if pool.portRule == nil {
+		return
+	}
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		// (already gone if another SOCKPool deleted it)
+		exec.Command(cmd, append([]string{"-w", "-D"}, pool.portRule...)...).Run()
+	}
+	pool.portRule = nil
+}
+
+func runNetCmd(args ...string) error {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// create a namespace for the sandbox with the given ID, set up per policy
+func (pool *netPool) create(id string, policy *common.NetworkPolicy) (sbNet *sandboxNet, err error) {
+	sbNet = &sandboxNet{pool: pool, nsName: pool.prefix + id, block: -1}
+
+	if err := runNetCmd("ip", "netns", "add", sbNet.nsName); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			sbNet.release()
+		}
+	}()
+
+	if policy.Mode == common.NET_NONE {
+		return sbNet, nil
+	}
+
+	if err := runNetCmd("ip", "-n", sbNet.nsName, "link", "set", "lo", "up"); err != nil {
+		return nil, err
+	}
+
+	if policy.Mode == common.NET_EGRESS {
+		if err := sbNet.connectEgress(policy.Allow); err != nil {
+			return nil, err
+		}
+	}
+
+	return sbNet, nil
+}
+
+// allocBlock reserves a /30 of the subnet: .0 network, .1 host side,
+// .2 sandbox side, .3 broadcast
+func (pool *netPool) allocBlock() (int, net.IP, net.IP, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.subnet == nil {
+		return -1, nil, nil, fmt.Errorf("network mode '%s' requires network.subnet in the worker config", common.NET_EGRESS)
+	}
+
+	if !pool.forwardingSet {
+		if err := os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
+			return -1, nil, nil, fmt.Errorf("could not enable IP forwarding: %v", err)
+		}
+		pool.forwardingSet = true
+	}
+
+	ones, bits := pool.subnet.Mask.Size()
+	blocks := 1 << (bits - ones - 2)
+	base := binary.BigEndian.Uint32(pool.subnet.IP.To4())
+
+	for i := 0; i < blocks; i++ {
+		if !pool.usedBlocks[i] {
+			pool.usedBlocks[i] = true
+			hostIP := make(net.IP, 4)
+			sbIP := make(net.IP, 4)
+			binary.BigEndian.PutUint32(hostIP, base+uint32(4*i)+1)
+			binary.BigEndian.PutUint32(sbIP, base+uint32(4*i)+2)
+			return i, hostIP, sbIP, nil
+		}
+	}
+
+	return -1, nil, nil, fmt.Errorf("no free addresses left in %s", pool.subnet)
+}
+
+func (pool *netPool) freeBlock(block int) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	delete(pool.usedBlocks, block)
+}
+
+func (sbNet *sandboxNet) connectEgress(allow []string) (err error) {
+	dests, err := resolveEgress(allow)
+	if err != nil {
+		return err
+	}
+
+	var hostIP, sbIP net.IP
+	sbNet.block, hostIP, sbIP, err = sbNet.pool.allocBlock()
+	if err != nil {
+		return err
+	}
+
+	// interface and chain names are limited to 15 and 28 chars, so
+	// they're named after the (unique) host side address
+	suffix := fmt.Sprintf("%08x", binary.BigEndian.Uint32(hostIP))
+	sbNet.hostIf = "olv" + suffix
+	sbIf := "ols" + suffix
+	ns := sbNet.nsName
+
+	cmds := [][]string{
+		{"ip", "link", "add", sbNet.hostIf, "type", "veth", "peer", "name", sbIf, "netns", ns},
+		{"ip", "addr", "add", hostIP.String() + "/30", "dev", sbNet.hostIf},
+		{"ip", "link", "set", sbNet.hostIf, "up"},
+		{"ip", "-n", ns, "link", "set", sbIf, "name", "eth0"},
+		{"ip", "-n", ns, "addr", "add", sbIP.String() + "/30", "dev", "eth0"},
+		{"ip", "-n", ns, "link", "set", "eth0", "up"},
+		{"ip", "-n", ns, "route", "add", "default", "via", hostIP.String()},
+	}
+	for _, cmd := range cmds {
+		if err := runNetCmd(cmd...); err != nil {
+			return err
+		}
+	}
+
+	// the chain gets everything the sandbox sends through the host
+	sbNet.chain = "OL-" + suffix
+	if err := runNetCmd("iptables", "-w", "-N", sbNet.chain); err != nil {
+		sbNet.chain = ""
+		return err
+	}
+
+	chainRules := [][]string{
+		// no talking to other sandboxes
+		{"-d", sbNet.pool.subnet.String(), "-j", "DROP"},
+	}
+	for _, dest := range dests {
+		if dest.Port == 0 {
+			chainRules = append(chainRules, []string{"-d", dest.Host, "-j", "ACCEPT"})
+			continue
+		}
+		for _, proto := range []string{"tcp", "udp"} {
+			chainRules = append(chainRules, []string{
+				"-d", dest.Host, "-p", proto, "--dport", fmt.Sprintf("%d", dest.Port), "-j", "ACCEPT"})
+		}
+	}
+	chainRules = append(chainRules, []string{"-j", "DROP"})
+
+	for _, rule := range chainRules {
+		if err := runNetCmd(append([]string{"iptables", "-w", "-A", sbNet.chain}, rule...)...); err != nil {
+			return err
+		}
+	}
+
+	comment := []string{"-m", "comment", "--comment", ns}
+	hostRules := [][]string{
+		// nothing on the worker itself (registry, admin endpoints,
+		// etc.) is reachable, whatever the allow list says
+		{"INPUT", "-i", sbNet.hostIf, "-j", "DROP"},
+		{"FORWARD", "-i", sbNet.hostIf, "-j", sbNet.chain},
+		{"FORWARD", "-o", sbNet.hostIf, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		{"-t", "nat", "POSTROUTING", "-s", sbIP.String() + "/32", "-j", "MASQUERADE"},
+	}
+
+	for _, rule := range hostRules {
+		rule = append(rule, comment...)
+		if err := runNetCmd(iptablesArgs("-I", rule)...); err != nil {
+			return err
+		}
+		sbNet.rules = append(sbNet.rules, rule)
+	}
+
+	return nil
+}
+
+// iptablesArgs builds an iptables command line for a rule, which may start
+// with "-t <table>" before the chain
+func iptablesArgs(op string, rule []string) []string {
+	args := []string{"iptables", "-w"}
+	if rule[0] == "-t" {
+		args = append(args, rule[:2]...)
+		rule = rule[2:]
+	}
+	args = append(args, op)
+	return append(args, rule...)
+}
+
+// resolveEgress turns allow entries into CIDRs, looking up DNS names now
+// (so a sandbox keeps the addresses it started with)
+func resolveEgress(allow []string) ([]common.EgressRule, error) {
+	var dests []common.EgressRule
+	for _, entry := range allow {
+		rule, err := common.ParseEgressRule(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(rule.Host, "/") || net.ParseIP(rule.Host) != nil {
+			dests = append(dests, rule)
+			continue
+		}
+
+		ips, err := net.LookupIP(rule.Host)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve network allow entry '%s': %v", entry, err)
+		}
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				dests = append(dests, common.EgressRule{Host: ip.String() + "/32", Port: rule.Port})
+			}
+		}
+	}
+	return dests, nil
+}
+
+// netnsPath is what the sandbox's processes should be started in
+func (sbNet *sandboxNet) netnsPath() string {
+	return filepath.Join(NETNS_DIR, sbNet.nsName)
+}
+
+// startIn starts cmd in the sandbox's network namespace, for processes
+// that can't be started with nsenter (e.g., because they are chrooted by
+// cmd.SysProcAttr).  The child inherits the namespace of the thread that
+// starts it, so this switches this goroutine's thread there and back.
+func (sbNet *sandboxNet) startIn(cmd *exec.Cmd) error {
+	runtime.LockOSThread()
+
+	hostNs, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer hostNs.Close()
+
+	sbNs, err := os.Open(sbNet.netnsPath())
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer sbNs.Close()
+
+	if err := unix.Setns(int(sbNs.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("setns to %s failed: %v", sbNet.nsName, err)
+	}
+
+	startErr := cmd.Start()
+
+	if err := unix.Setns(int(hostNs.Fd()), unix.CLONE_NEWNET); err != nil {
+		// leave the thread locked, so that it exits with this
+		// goroutine instead of running others in the wrong namespace
+		if startErr == nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+		return fmt.Errorf("could not return to host network namespace: %v", err)
+	}
+	runtime.UnlockOSThread()
+	return startErr
+}
+
+// release undoes everything create did (deleting the namespace also
+// deletes the veth pair)
+func (sbNet *sandboxNet) release() {
+	for _, rule := range sbNet.rules {
+		if err := runNetCmd(iptablesArgs("-D", rule)...); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+	sbNet.rules = nil
+
+	if sbNet.chain != "" {
+		if err := runNetCmd("iptables", "-w", "-F", sbNet.chain); err != nil {
+			slog.Error(err.Error())
+		}
+		if err := runNetCmd("iptables", "-w", "-X", sbNet.chain); err != nil {
+			slog.Error(err.Error())
+		}
+		sbNet.chain = ""
+	}
+
+	if err := runNetCmd("ip", "netns", "del", sbNet.nsName); err != nil {
+		slog.Error(err.Error())
+	}
+
+	if sbNet.block >= 0 {
+		sbNet.pool.freeBlock(sbNet.block)
+		sbNet.block = -1
+	}
+}
+
+func (sbNet *sandboxNet) String() string {
+	if sbNet.hostIf == "" {
+		return sbNet.nsName
+	}
+	return fmt.Sprintf("%s (via %s)", sbNet.nsName, sbNet.hostIf)
+}
+
+// CleanupNetworks deletes the sandbox network namespaces and iptables
+// rules left behind by the worker on the given port (e.g., after a
+// crash).  It returns the number of errors encountered.
+func CleanupNetworks(workerPort string, subnet string) int {
+	prefix := networkPrefix(workerPort)
+	errCount := 0
+
+	// host rules first, as they reference the chains (ip6tables only
+	// has the rule for the worker's port)
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		for _, table := range []string{"filter", "nat"} {
+			out, err := exec.Command(cmd, "-w", "-t", table, "-S").Output()
+			if err != nil {
+				// e.g., no iptables installed, so no rules of ours either
+				continue
+			}
+			for _, line := range strings.Split(string(out), "\n") {
+				if !strings.HasPrefix(line, "-A ") || !strings.Contains(line, "--comment "+prefix) {
+					continue
+				}
+				args := append([]string{cmd, "-w", "-t", table, "-D"}, strings.Fields(line)[1:]...)
+				if err := runNetCmd(args...); err != nil {
+					slog.Error(err.Error())
+					errCount++
+				}
+			}
+		}
+	}
+
+	// per-sandbox chains are named after addresses in our subnet
+	if _, ipnet, err := net.ParseCIDR(subnet); err == nil {
+		out, _ := exec.Command("iptables", "-w", "-S").Output()
+		for _, line := range strings.Split(string(out), "\n") {
+			chain, ok := strings.CutPrefix(line, "-N OL-")
+			if !ok || len(chain) != 8 {
+				continue
+			}
+			var addr uint32
+			if _, err := fmt.Sscanf(chain, "%08x", &addr); err != nil {
+				continue
+			}
+			ip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(ip, addr)
+			if !ipnet.Contains(ip) {
+				continue
+			}
+			for _, op := range []string{"-F", "-X"} {
+				if err := runNetCmd("iptables", "-w", op, "OL-"+chain); err != nil {
+					slog.Error(err.Error())
+					errCount++
+				}
+			}
+		}
+	}
+
+	entries, _ := os.ReadDir(NETNS_DIR)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) {
+			if err := runNetCmd("ip", "netns", "del", entry.Name()); err != nil {
+				slog.Error(err.Error())
+				errCount++
+			}
+		}
+	}
+
+	return errCount
+}
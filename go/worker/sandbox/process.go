@@ -0,0 +1,221 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+	"golang.org/x/sys/unix"
+)
+
+// ProcessSandbox is a Python runtime running directly on the host (see
+// ProcessPool).  It is the leader of its own process group, so that
+// signals reach anything the lambda spawns.
+type ProcessSandbox struct {
+	id         string
+	scratchDir string
+	meta       *SandboxMeta
+	cmd        *exec.Cmd
+	exited     chan struct{}
+	httpClient *http.Client
+}
+
+// start runs server_legacy.py (from the image's base) with the host's
+// python3, pointing it at the code and scratch dirs in place of
+// /handler and /host.
+func (sb *ProcessSandbox) start(img *common.ImageConfig, codeDir string) error {
+	server := filepath.Join(img.SOCK_base_path, "runtimes", "python", "server_legacy.py")
+
+	// only what python needs from the worker's environment (which
+	// may hold credentials); the lambda's own comes from the .env
+	// file that the runtime loads
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + os.Getenv("HOME"),
+		"OL_HOST_DIR=" + sb.scratchDir,
+		"OL_PKGS_DIR=" + img.Pkgs_dir,
+		"OL_HANDLER_DIR=" + codeDir,
+		"PYTHONPATH=" + pythonPath(img.Pkgs_dir, sb.meta.Installs),
+	}
+
+	cmd := exec.Command("python3", server)
+	cmd.Env = env
+	cmd.Dir = sb.scratchDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	closeLog, err := setRuntimeOutput(cmd, sb.scratchDir)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start %s :: %v", server, err)
+	}
+	sb.cmd = cmd
+
+	sb.exited = make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(sb.exited)
+	}()
+
+	// exec.Cmd cannot set rlimits before exec, so this races with the
+	// first few instructions of python, which is fine for limits that
+	// only matter once the lambda is loaded.  Children inherit them.
+	return sb.setRlimits()
+}
+
+func (sb *ProcessSandbox) setRlimits() error {
+	pid := sb.cmd.Process.Pid
+	memBytes := uint64(sb.meta.MemLimitMB) * 1024 * 1024
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		// RLIMIT_AS would count address space python reserves but
+		// never touches; RLIMIT_DATA is closer to a memory limit
+		{unix.RLIMIT_DATA, memBytes},
+		{unix.RLIMIT_CORE, 0},
+	}
+	for _, limit := range limits {
+		rlim := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Prlimit(pid, limit.resource, &rlim, nil); err != nil {
+			return fmt.Errorf("could not set rlimit %d of pid %d :: %v", limit.resource, pid, err)
+		}
+	}
+	return nil
+}
+
+// signal sends sig to every process in the Sandbox
+func (sb *ProcessSandbox) signal(sig syscall.Signal) error {
+	if sb.cmd == nil || sb.cmd.Process == nil {
+		return fmt.Errorf("process sandbox %s was never started", sb.id)
+	}
+	select {
+	case <-sb.exited:
+		return fmt.Errorf("process sandbox %s exited unexpectedly", sb.id)
+	default:
+	}
+	return syscall.Kill(-sb.cmd.Process.Pid, sig)
+}
+
+func (sb *ProcessSandbox) ID() string {
+	return sb.id
+}
+
+// Pause stops every process in the Sandbox.  The memory they use is not
+// freed or accounted for anywhere, unlike a paused SOCK container.
+func (sb *ProcessSandbox) Pause() error {
+	if err := sb.signal(syscall.SIGSTOP); err != nil {
+		return err
+	}
+
+	// idle connections use a LOT of memory in the OL process
+	sb.httpClient.CloseIdleConnections()
+
+	if err := capRuntimeLog(sb.scratchDir); err != nil {
+		slog.Error(fmt.Sprintf("could not cap runtime log of %s: %v", sb.id, err))
+	}
+	return nil
+}
+
+// Unpause continues every process in the Sandbox.
+func (sb *ProcessSandbox) Unpause() error {
+	return sb.signal(syscall.SIGCONT)
+}
+
+// Destroy kills the process group, and removes the files the worker
+// created for it
+func (sb *ProcessSandbox) Destroy(_ string) {
+	if sb.cmd != nil && sb.cmd.Process != nil {
+		// a stopped process still dies from SIGKILL
+		syscall.Kill(-sb.cmd.Process.Pid, syscall.SIGKILL)
+		<-sb.exited
+	}
+
+	for _, name := range []string{"ol.sock", "server_pipe", SECRETS_ENV_NAME} {
+		os.RemoveAll(filepath.Join(sb.scratchDir, name))
+	}
+}
+
+func (sb *ProcessSandbox) Shutdown(reason string) {
+	if grace := shutdownGrace(); grace > 0 && sb.cmd != nil && sb.cmd.Process != nil {
+		deadline := time.Now().Add(grace)
+		if err := sb.Unpause(); err == nil {
+			if !requestShutdown(sb.httpClient, deadline) {
+				sb.signal(syscall.SIGTERM)
+			}
+			select {
+			case <-sb.exited:
+			case <-time.After(time.Until(deadline)):
+			}
+		}
+	}
+
+	sb.Destroy(reason)
+}
+
+func (sb *ProcessSandbox) DestroyIfPaused(reason string) {
+	sb.Destroy(reason) // we're allowed to implement this by uncondationally destroying
+}
+
+func (sb *ProcessSandbox) Client() *http.Client {
+	return sb.httpClient
+}
+
+func (sb *ProcessSandbox) Meta() *SandboxMeta {
+	return sb.meta
+}
+
+// GetRuntimeLog returns the output of python, followed by the lambda's
+// output (which server_legacy.py redirects to stdout and stderr files)
+func (sb *ProcessSandbox) GetRuntimeLog() string {
+	var log strings.Builder
+	for _, name := range []string{RUNTIME_LOG_NAME, "stdout", "stderr"} {
+		if data, err := ioutil.ReadFile(filepath.Join(sb.scratchDir, name)); err == nil {
+			log.Write(data)
+		}
+	}
+	return log.String()
+}
+
+// GetProxyLog returns "", as the process sandbox has no proxy
+func (*ProcessSandbox) GetProxyLog() string {
+	return ""
+}
+
+// OOMKills is not supported: rlimits make allocations fail (e.g., with
+// a MemoryError) rather than kill the process
+func (*ProcessSandbox) OOMKills() (int64, error) {
+	return 0, fmt.Errorf("OOM kills not tracked for process Sandboxes")
+}
+
+// StartUsage is not supported, as the runtime has no cgroup of its own
+func (*ProcessSandbox) StartUsage() (func() (Usage, error), error) {
+	return nil, fmt.Errorf("usage metering not supported for process Sandboxes")
+}
+
+func (sb *ProcessSandbox) DebugString() string {
+	pid := 0
+	if sb.cmd != nil && sb.cmd.Process != nil {
+		pid = sb.cmd.Process.Pid
+	}
+	return fmt.Sprintf("SANDBOX %s (PROCESS, NOT ISOLATED)\nPID: %d\nSCRATCH: %s\n", sb.id, pid, sb.scratchDir)
+}
+
+func (*ProcessSandbox) fork(_ Sandbox) (err error) {
+	panic("ProcessSandbox does not implement cross-sandbox forks")
+}
+
+func (*ProcessSandbox) childExit(_ Sandbox) {
+	panic("ProcessSandboxes should not have children because fork is unsupported")
+}
@@ -0,0 +1,151 @@
+package sandbox
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// ProcessPool creates Sandboxes that are just processes on the host,
+// running as the worker's user.  It needs no privileges, which makes
+// it handy on development machines, but it provides NO ISOLATION:
+// lambdas can see (and modify) everything the worker's user can, and
+// the only limits are rlimits.  Never use it for untrusted code.
+type ProcessPool struct {
+	idxPtr        *int64
+	eventHandlers []SandboxEventFunc
+	debugger
+}
+
+// NewProcessPool creates a ProcessPool.
+func NewProcessPool() (*ProcessPool, error) {
+	slog.Warn("the process sandbox does NOT isolate lambdas from each other or from the host; only use it for development")
+
+	var sharedIdx int64 = -1
+	pool := &ProcessPool{
+		idxPtr:        &sharedIdx,
+		eventHandlers: []SandboxEventFunc{},
+	}
+	pool.debugger = newDebugger(pool)
+	return pool, nil
+}
+
+// processUnsupported reports why a Sandbox with this meta cannot be a process
+// (features that depend on namespaces or mounts), or "" if it can
+func (meta *SandboxMeta) processUnsupported() string {
+	switch {
+	case meta.Runtime != common.RT_PYTHON:
+		return "runtimes other than python"
+	case meta.Network.Isolated():
+		return "network isolation"
+	case meta.Seccomp != nil:
+		return "seccomp profiles"
+	case len(meta.Volumes) > 0:
+		return "volumes"
+	case meta.WritableRoot:
+		return "writable roots"
+	case meta.ScratchMB > 0:
+		return "scratch quotas"
+	case meta.hasIOLimits():
+		return "IO limits"
+	}
+	return ""
+}
+
+// Create starts the Python runtime as a subprocess serving on ol.sock in
+// the scratch dir.
+func (pool *ProcessPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir string, meta *SandboxMeta) (sb Sandbox, err error) {
+	meta = fillMetaDefaults(meta)
+	t := common.T0("Create()")
+	defer t.T1()
+
+	if parent != nil {
+		panic("Create parent not supported for ProcessPool")
+	} else if !isLeaf {
+		panic("Non-leaves not supported for ProcessPool")
+	}
+
+	if feature := meta.processUnsupported(); feature != "" {
+		return nil, fmt.Errorf("the process sandbox does not support %s", feature)
+	}
+
+	img, err := common.Conf.Image(meta.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	sockPath := filepath.Join(scratchDir, "ol.sock")
+	if len(sockPath) > 108 {
+		return nil, fmt.Errorf("socket path length cannot exceed 108 characters (try moving cluster closer to the root directory")
+	}
+
+	// pipe for synchronization before socket is ready
+	pipe := filepath.Join(scratchDir, "server_pipe")
+	if err := os.RemoveAll(pipe); err != nil {
+		return nil, err
+	}
+	if err := syscall.Mkfifo(pipe, 0777); err != nil {
+		return nil, err
+	}
+
+	c := &ProcessSandbox{
+		id:         fmt.Sprintf("%d", atomic.AddInt64(pool.idxPtr, 1)),
+		scratchDir: scratchDir,
+		meta:       meta,
+	}
+
+	if err := c.start(img, codeDir); err != nil {
+		c.Destroy("c.start() failed")
+		return nil, err
+	}
+
+	if err := waitForServerPipeReady(scratchDir); err != nil {
+		c.Destroy("waitForServerPipeReady failed")
+		return nil, err
+	}
+
+	dial := func(_, _ string) (net.Conn, error) {
+		return net.Dial("unix", sockPath)
+	}
+
+	c.httpClient = &http.Client{
+		Transport: &http.Transport{Dial: dial},
+		Timeout:   time.Second * time.Duration(common.Conf.Limits.Runtime_sec),
+	}
+
+	// wrap to make thread-safe and handle process death
+	safe := newSafeSandbox(c)
+	safe.startNotifyingListeners(pool.eventHandlers)
+	return safe, nil
+}
+
+// Cleanup does nothing, as each Sandbox kills its own processes
+func (*ProcessPool) Cleanup() {}
+
+// DebugString returns debug information
+func (pool *ProcessPool) DebugString() string {
+	return pool.debugger.Dump()
+}
+
+// AddListener allows registering event handlers
+func (pool *ProcessPool) AddListener(handler SandboxEventFunc) {
+	pool.eventHandlers = append(pool.eventHandlers, handler)
+}
+
+// pythonPath lists the install dirs of the packages a Sandbox uses
+func pythonPath(pkgsDir string, installs []string) string {
+	dirs := make([]string, len(installs))
+	for i, pkg := range installs {
+		dirs[i] = filepath.Join(pkgsDir, pkg, "files")
+	}
+	return strings.Join(dirs, ":")
+}
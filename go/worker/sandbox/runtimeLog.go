@@ -0,0 +1,79 @@
+package sandbox
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// setRuntimeOutput points the stdout and stderr of a runtime that is
+// about to be started at the runtime log in scratchDir, or at the
+// worker's own output if runtime_log_kb is 0.  The runtime gets its own
+// copy of the fd, so the returned func (which closes ours) should be
+// called once it has started.
+func setRuntimeOutput(cmd *exec.Cmd, scratchDir string) (func(), error) {
+	if common.Conf.Runtime_log_kb == 0 {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return func() {}, nil
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(scratchDir, RUNTIME_LOG_NAME),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	return func() { logFile.Close() }, nil
+}
+
+// runtimeLogEnv tells the Python runtime to send its output (and that
+// of Sandboxes forked from it) to /host/ol-runtime.log
+func runtimeLogEnv() []string {
+	if common.Conf.Runtime_log_kb == 0 {
+		return nil
+	}
+	return []string{"OL_RUNTIME_LOG=/host/" + RUNTIME_LOG_NAME}
+}
+
+// capRuntimeLog moves the runtime log in scratchDir to
+// RUNTIME_LOG_NAME.1 once it passes runtime_log_kb.  The runtime keeps
+// appending to its fd, so the log is copied, then truncated, rather than
+// renamed (a few lines written in between may be lost).
+func capRuntimeLog(scratchDir string) error {
+	if common.Conf.Runtime_log_kb == 0 {
+		return nil
+	}
+
+	path := filepath.Join(scratchDir, RUNTIME_LOG_NAME)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() <= int64(common.Conf.Runtime_log_kb)*1024 {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".1")
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return os.Truncate(path, 0)
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/open-lambda/open-lambda/go/common"
 )
@@ -24,6 +25,10 @@ type safeSandbox struct {
 	paused        bool
 	dead          error
 	eventHandlers []SandboxEventFunc
+
+	// how long the pool took to create the Sandbox (0 if unknown), a
+	// measure of what evicting it costs
+	createLatency time.Duration
 }
 
 // caller is responsible for calling startNotifyingListeners after
@@ -97,6 +102,24 @@ func (sb *safeSandbox) Destroy(reason string) {
 	sb.event(EvDestroy)
 }
 
+func (sb *safeSandbox) Shutdown(reason string) {
+	sb.printf("Shutdown()")
+	t := common.T0("Shutdown()")
+	defer t.T1()
+	sb.Mutex.Lock()
+	defer sb.Mutex.Unlock()
+
+	if sb.dead != nil {
+		return
+	}
+
+	sb.Sandbox.Shutdown(reason)
+	sb.dead = SandboxDeadError(fmt.Sprintf("Sandbox previously shut down by Shutdown(reason=%s) call", reason))
+
+	// let anybody interested know this died
+	sb.event(EvDestroy)
+}
+
 func (sb *safeSandbox) DestroyIfPaused(reason string) {
 	sb.printf("DestroyIfPaused()")
 	t := common.T0("DestroyIfPaused()")
@@ -218,6 +241,30 @@ func (sb *safeSandbox) childExit(child Sandbox) {
 	}
 }
 
+func (sb *safeSandbox) OOMKills() (int64, error) {
+	sb.Mutex.Lock()
+	defer sb.Mutex.Unlock()
+
+	if sb.dead != nil {
+		return 0, sb.dead
+	}
+
+	return sb.Sandbox.OOMKills()
+}
+
+// StartUsage doesn't destroy the Sandbox on error, as metering is
+// optional, and stop may run concurrently with other calls
+func (sb *safeSandbox) StartUsage() (func() (Usage, error), error) {
+	sb.Mutex.Lock()
+	defer sb.Mutex.Unlock()
+
+	if sb.dead != nil {
+		return nil, sb.dead
+	}
+
+	return sb.Sandbox.StartUsage()
+}
+
 func (sb *safeSandbox) DebugString() string {
 	sb.Mutex.Lock()
 	defer sb.Mutex.Unlock()
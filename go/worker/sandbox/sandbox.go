@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/open-lambda/open-lambda/go/common"
+	"github.com/open-lambda/open-lambda/go/worker/sandbox/cgroups"
 )
 
 func SandboxPoolFromConfig(name string, sizeMb int) (cf SandboxPool, err error) {
@@ -16,8 +17,12 @@ func SandboxPoolFromConfig(name string, sizeMb int) (cf SandboxPool, err error)
 		if err != nil {
 			return nil, err
 		}
-		NewSOCKEvictor(pool)
+		if _, err := NewSOCKEvictor(pool); err != nil {
+			return nil, err
+		}
 		return pool, nil
+	} else if common.Conf.Sandbox == "process" {
+		return NewProcessPool()
 	}
 
 	return nil, fmt.Errorf("invalid sandbox type: '%s'", common.Conf.Sandbox)
@@ -36,9 +41,44 @@ func fillMetaDefaults(meta *SandboxMeta) *SandboxMeta {
 	return meta
 }
 
+// ioMax is the io.max of a Sandbox's cgroup
+func (meta *SandboxMeta) ioMax() cgroups.IOMax {
+	return cgroups.IOMax{
+		ReadBps:   int64(meta.IOReadMBps) * 1024 * 1024,
+		WriteBps:  int64(meta.IOWriteMBps) * 1024 * 1024,
+		ReadIOPS:  int64(meta.IOReadIOPS),
+		WriteIOPS: int64(meta.IOWriteIOPS),
+	}
+}
+
+func (meta *SandboxMeta) hasIOLimits() bool {
+	return meta.ioMax() != cgroups.IOMax{}
+}
+
 func (meta *SandboxMeta) String() string {
-	return fmt.Sprintf("<installs=[%s], imports=[%s], mem-limit-mb=%v>",
-		strings.Join(meta.Installs, ","), strings.Join(meta.Imports, ","), meta.MemLimitMB)
+	seccomp := "worker-default"
+	if meta.Seccomp != nil {
+		seccomp = meta.Seccomp.String()
+	}
+	volumes := make([]string, len(meta.Volumes))
+	for i, vol := range meta.Volumes {
+		volumes[i] = vol.String()
+	}
+	image := meta.Image
+	if image == "" {
+		image = common.DEFAULT_IMAGE
+	}
+	return fmt.Sprintf("<image=%s, installs=[%s], imports=[%s], mem-limit-mb=%v, network=%s, seccomp=%s, volumes=[%s], scratch-mb=%v, writable-root=%v, eviction-priority=%d, priority-class=%s, cpu-weight=%d, cpu-pinned=%v, io-max=%+v>",
+		image, strings.Join(meta.Installs, ","), strings.Join(meta.Imports, ","), meta.MemLimitMB, meta.Network, seccomp,
+		strings.Join(volumes, ","), meta.ScratchMB, meta.WritableRoot, meta.EvictionPriority, meta.PriorityClass,
+		meta.CPUWeight, meta.CPUPinned, meta.ioMax())
+}
+
+// CanForkFromZygote reports whether a sandbox with this meta may be forked
+// from a zygote.  Zygotes share the host network and have the worker's
+// default seccomp filter, which forked children would inherit.
+func (meta *SandboxMeta) CanForkFromZygote() bool {
+	return !meta.Network.Isolated() && meta.Seccomp == nil
 }
 
 func (e SandboxError) Error() string {
@@ -0,0 +1,76 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// a scratch dir with less free space than this is considered full
+const scratchFullBytes = 64 * 1024
+
+// MountScratchQuota limits a new (empty) scratch dir to sizeMB, by mounting
+// a tmpfs of that size over it.  Sandboxes created with the dir (and
+// SandboxMeta.ScratchMB set) unmount it when they are destroyed.
+//
+// Note that tmpfs pages are charged to the memory cgroup of the sandbox
+// that writes them.
+func MountScratchQuota(scratchDir string, sizeMB int) error {
+	if sizeMB <= 0 {
+		return nil
+	}
+	opts := fmt.Sprintf("size=%dm,mode=777", sizeMB)
+	if err := syscall.Mount("none", scratchDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, opts); err != nil {
+		return fmt.Errorf("failed to mount %d MB scratch quota at %s :: %v", sizeMB, scratchDir, err)
+	}
+	return nil
+}
+
+// ReleaseScratchQuota unmounts the tmpfs of MountScratchQuota (discarding
+// what's in it) and removes the dir
+func ReleaseScratchQuota(scratchDir string) error {
+	if _, err := os.Stat(scratchDir); os.IsNotExist(err) {
+		return nil // already released
+	}
+	if err := syscall.Unmount(scratchDir, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount scratch dir %s failed :: %v", scratchDir, err)
+	}
+	return os.Remove(scratchDir)
+}
+
+// scratchUsage reports the used and total size of a scratch dir with a
+// quota, in MB
+func scratchUsage(scratchDir string) (usedMB, sizeMB float64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(scratchDir, &st); err != nil {
+		return 0, 0, err
+	}
+	size := float64(st.Blocks) * float64(st.Bsize)
+	free := float64(st.Bfree) * float64(st.Bsize)
+	return (size - free) / 1024 / 1024, size / 1024 / 1024, nil
+}
+
+// ScratchQuotaExceeded reports whether a scratch dir with a quota has
+// (practically) run out of space, which is a likely reason for a lambda
+// to have failed
+func ScratchQuotaExceeded(scratchDir string, meta *SandboxMeta) bool {
+	if meta.ScratchMB <= 0 {
+		return false
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(scratchDir, &st); err != nil {
+		return false
+	}
+	return uint64(st.Bavail)*uint64(st.Bsize) < scratchFullBytes
+}
+
+func scratchDebugString(scratchDir string, meta *SandboxMeta) string {
+	if meta.ScratchMB <= 0 {
+		return ""
+	}
+	used, size, err := scratchUsage(scratchDir)
+	if err != nil {
+		return fmt.Sprintf("SCRATCH: %v\n", err)
+	}
+	return fmt.Sprintf("SCRATCH: %.1f MB used of %.0f MB\n", used, size)
+}
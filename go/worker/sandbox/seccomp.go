@@ -0,0 +1,103 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// the allowlist compiled into the runtimes (no profile file needed)
+const BUILTIN_SECCOMP_PROFILE = "default"
+
+// name of the file, within a Sandbox's scratch dir, that tells the
+// runtime which seccomp filter to install
+const SECCOMP_PROFILE_NAME = "ol-seccomp.json"
+
+// SeccompProfile is a named syscall allowlist, as applied to a sandbox
+type SeccompProfile struct {
+	Name string `json:"name"`
+	// nil means the runtime's built-in allowlist
+	Syscalls []string `json:"syscalls"`
+	// if true, denied syscalls are logged (by the kernel) and allowed
+	Audit bool `json:"audit"`
+}
+
+// LoadSeccompProfile reads <Seccomp.Profiles_dir>/<name>.json ("" means
+// the worker's default profile)
+func LoadSeccompProfile(name string, audit bool) (*SeccompProfile, error) {
+	if name == "" {
+		name = common.Conf.Seccomp.Default_profile
+	}
+	if name == "" || name == BUILTIN_SECCOMP_PROFILE {
+		return &SeccompProfile{Name: BUILTIN_SECCOMP_PROFILE, Audit: audit}, nil
+	}
+
+	if !common.HandlerNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid seccomp profile name '%s'", name)
+	}
+
+	path := filepath.Join(common.Conf.Seccomp.Profiles_dir, name+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read seccomp profile '%s': %w", name, err)
+	}
+
+	var file struct {
+		Syscalls []string `json:"syscalls"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse seccomp profile %s: %w", path, err)
+	}
+	if file.Syscalls == nil {
+		return nil, fmt.Errorf("seccomp profile %s has no syscalls list", path)
+	}
+
+	return &SeccompProfile{Name: name, Syscalls: file.Syscalls, Audit: audit}, nil
+}
+
+// SeccompProfileFor resolves a lambda's seccomp policy.  It returns nil if
+// the worker's default profile (unaudited) applies.
+func SeccompProfileFor(policy *common.SeccompPolicy) (*SeccompProfile, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	if !policy.Audit && (policy.Profile == "" || policy.Profile == common.Conf.Seccomp.Default_profile) {
+		return nil, nil
+	}
+	return LoadSeccompProfile(policy.Profile, policy.Audit)
+}
+
+func (p *SeccompProfile) String() string {
+	if p.Audit {
+		return p.Name + "(audit)"
+	}
+	return p.Name
+}
+
+// dockerSecurityOpt converts the profile to Docker's seccomp format
+func (p *SeccompProfile) dockerSecurityOpt() (string, error) {
+	if p.Syscalls == nil {
+		// Docker's own default profile is similar to the built-in one
+		return "", nil
+	}
+
+	defaultAction := "SCMP_ACT_ERRNO"
+	if p.Audit {
+		defaultAction = "SCMP_ACT_LOG"
+	}
+
+	profile := map[string]any{
+		"defaultAction": defaultAction,
+		"syscalls": []map[string]any{
+			{"names": p.Syscalls, "action": "SCMP_ACT_ALLOW"},
+		},
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return "", err
+	}
+	return "seccomp=" + string(data), nil
+}
@@ -0,0 +1,68 @@
+package sandbox
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// the runtime's endpoint for shutdown requests (see server_common.py),
+// after which it runs the lambda's on_shutdown hook and exits
+const SHUTDOWN_PATH = "/_ol/shutdown"
+
+// how often we check whether a Sandbox's processes have exited
+const SHUTDOWN_POLL_INTERVAL = 10 * time.Millisecond
+
+// set by EndShutdownsBy (in UnixNano); 0 if shutdowns are not capped
+var shutdownsEnd atomic.Int64
+
+// EndShutdownsBy caps the grace of every Shutdown from now on at
+// deadline, so that Sandboxes that are shut down one after another
+// (e.g., while the worker exits) take one grace period in total, rather
+// than one each.
+func EndShutdownsBy(deadline time.Time) {
+	shutdownsEnd.Store(deadline.UnixNano())
+}
+
+// shutdownGrace is how long Shutdown lets a Sandbox exit on its own
+func shutdownGrace() time.Duration {
+	grace := time.Duration(common.Conf.Shutdown_grace_ms) * time.Millisecond
+	if end := shutdownsEnd.Load(); end != 0 {
+		grace = min(grace, time.Until(time.Unix(0, end)))
+	}
+	return grace
+}
+
+// requestShutdown POSTs to SHUTDOWN_PATH over client, returning whether
+// the runtime agreed (after running the hook) before the deadline.
+// Runtimes without the endpoint (e.g., custom ones) typically don't.
+func requestShutdown(client *http.Client, deadline time.Time) bool {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://root"+SHUTDOWN_PATH, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// waitUntil polls done until it returns true (then waitUntil does too)
+// or the deadline passes
+func waitUntil(deadline time.Time, done func() bool) bool {
+	for !done() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(SHUTDOWN_POLL_INTERVAL)
+	}
+	return true
+}
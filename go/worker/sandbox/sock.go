@@ -1,6 +1,7 @@
 package sandbox
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log/slog"
@@ -28,6 +29,18 @@ type SOCKContainer struct {
 	cg               cgroups.Cgroup
 	client           *http.Client
 
+	// oom_kill count of the cgroup when we got it (cgroups may be
+	// recycled, so earlier Sandboxes' kills are not ours)
+	oomKillsAtStart int64
+	// likewise for io.stat
+	ioAtStart cgroups.IOStat
+
+	// nil if the sandbox shares the host network
+	net *sandboxNet
+
+	// pid of a custom runtime (0 for other runtimes)
+	customPid int
+
 	// 1 for self, plus 1 for each child (we can't release memory
 	// until all descendants are dead, because they share the
 	// pages of this Container, but this is the only container
@@ -66,10 +79,14 @@ func (container *SOCKContainer) freshProc() (err error) {
 	var cmd *exec.Cmd
 
 	if container.meta.Runtime == common.RT_PYTHON {
+		seccompArg, err := container.seccompArg()
+		if err != nil {
+			return err
+		}
 		cmd = exec.Command(
 			"chroot", container.containerRootDir, "python3", "-u",
 			"/runtimes/python/server.py", "/host/bootstrap.py", strconv.Itoa(1),
-			strconv.FormatBool(common.Conf.Features.Enable_seccomp),
+			seccompArg,
 		)
 	} else if container.meta.Runtime == common.RT_NATIVE {
 		if container.containerProxy == nil {
@@ -85,16 +102,30 @@ func (container *SOCKContainer) freshProc() (err error) {
 			"env", "RUST_BACKTRACE=full", "/runtimes/native/server", strconv.Itoa(1),
 			strconv.FormatBool(common.Conf.Features.Enable_seccomp),
 		)
+	} else if container.meta.Runtime == common.RT_CUSTOM {
+		return container.startCustomRuntime(cgFiles[0])
 	} else {
 		return fmt.Errorf("Unsupported runtime")
 	}
 
-	cmd.Env = []string{} // for security, DO NOT expose host env to guest
+	if container.net != nil {
+		cmd.Args = append([]string{"nsenter", "--net=" + container.net.netnsPath()}, cmd.Args...)
+		if cmd.Path, err = exec.LookPath("nsenter"); err != nil {
+			return err
+		}
+	}
+
+	// for security, DO NOT expose host env to guest (a nil Env would)
+	cmd.Env = append([]string{}, runtimeLogEnv()...)
 	cmd.ExtraFiles = cgFiles
 
-	// TODO: route this to a file
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// runtime output goes to the scratch dir (if runtime_log_kb is
+	// set), where GetRuntimeLog and `ol admin dev` can find it
+	closeLog, err := setRuntimeOutput(cmd, container.scratchDir)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
 
 	if err := cmd.Start(); err != nil {
 		return err
@@ -105,6 +136,28 @@ func (container *SOCKContainer) freshProc() (err error) {
 	return cmd.Wait()
 }
 
+// seccompArg tells the Python runtime what filter to install: "false" for
+// none, or the path (inside the sandbox) of the profile to apply
+func (container *SOCKContainer) seccompArg() (string, error) {
+	if !common.Conf.Features.Enable_seccomp {
+		return "false", nil
+	}
+
+	profile := container.meta.Seccomp
+	if profile == nil {
+		profile = container.pool.seccomp
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(container.scratchDir, SECCOMP_PROFILE_NAME), data, 0644); err != nil {
+		return "", err
+	}
+	return "/host/" + SECCOMP_PROFILE_NAME, nil
+}
+
 func (container *SOCKContainer) launchContainerProxy() (err error) {
 	args := []string{}
 	args = append(args, "ol-container-proxy")
@@ -178,13 +231,23 @@ func (container *SOCKContainer) launchContainerProxy() (err error) {
 
 func (container *SOCKContainer) populateRoot() (err error) {
 	// FILE SYSTEM STEP 1: mount base
-	baseDir := common.Conf.SOCK_base_path
-	if err := syscall.Mount(baseDir, container.containerRootDir, "", common.BIND, ""); err != nil {
-		return fmt.Errorf("failed to bind root dir: %s -> %s :: %v", baseDir, container.containerRootDir, err)
+	img, err := common.Conf.Image(container.meta.Image)
+	if err != nil {
+		return err
 	}
+	baseDir := img.SOCK_base_path
+	if container.meta.WritableRoot {
+		if err := container.mountRootOverlay(baseDir); err != nil {
+			return err
+		}
+	} else {
+		if err := syscall.Mount(baseDir, container.containerRootDir, "", common.BIND, ""); err != nil {
+			return fmt.Errorf("failed to bind root dir: %s -> %s :: %v", baseDir, container.containerRootDir, err)
+		}
 
-	if err := syscall.Mount("none", container.containerRootDir, "", common.BIND_RO, ""); err != nil {
-		return fmt.Errorf("failed to bind root dir RO: %s :: %v", container.containerRootDir, err)
+		if err := syscall.Mount("none", container.containerRootDir, "", common.BIND_RO, ""); err != nil {
+			return fmt.Errorf("failed to bind root dir RO: %s :: %v", container.containerRootDir, err)
+		}
 	}
 
 	if err := syscall.Mount("none", container.containerRootDir, "", common.PRIVATE, ""); err != nil {
@@ -221,6 +284,33 @@ func (container *SOCKContainer) populateRoot() (err error) {
 		return fmt.Errorf("failed to bind tmp dir: %v", err.Error())
 	}
 
+	// FILE SYSTEM STEP 4: worker volumes
+	if len(container.meta.Volumes) > 0 {
+		if err := mountVolumes(container.containerRootDir, container.meta.Volumes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mountRootOverlay stacks a writable upper dir over the base image.  The
+// upper dir is in the scratch dir, so it counts against the scratch quota
+// (if any), and is discarded with the Sandbox.
+func (container *SOCKContainer) mountRootOverlay(baseDir string) error {
+	overlayDir := filepath.Join(container.scratchDir, ROOT_OVERLAY_NAME)
+	upperDir := filepath.Join(overlayDir, "upper")
+	workDir := filepath.Join(overlayDir, "work")
+	for _, dir := range []string{upperDir, workDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", baseDir, upperDir, workDir)
+	if err := syscall.Mount("overlay", container.containerRootDir, "overlay", 0, opts); err != nil {
+		return fmt.Errorf("failed to mount overlay root: %s -> %s :: %v", baseDir, container.containerRootDir, err)
+	}
 	return nil
 }
 
@@ -245,6 +335,10 @@ func (container *SOCKContainer) Pause() (err error) {
 	// save a little memory
 	container.client.CloseIdleConnections()
 
+	if err := capRuntimeLog(container.scratchDir); err != nil {
+		container.printf("could not cap runtime log: %v", err)
+	}
+
 	return nil
 }
 
@@ -271,6 +365,51 @@ func (container *SOCKContainer) Destroy(_ string) {
 	container.decCgRefCount()
 }
 
+func (container *SOCKContainer) Shutdown(reason string) {
+	if grace := shutdownGrace(); grace > 0 {
+		deadline := time.Now().Add(grace)
+		// (Unpause restores a downsized memory limit through the
+		// pool, before the runtime gets to use it again)
+		if err := container.Unpause(); err != nil {
+			container.printf("cannot unpause for shutdown: %v", err)
+		} else if !requestShutdown(container.client, deadline) {
+			container.terminate(deadline)
+		}
+	}
+
+	container.Destroy(reason)
+}
+
+// terminate sends SIGTERM to the processes of the Sandbox, and waits
+// (until the deadline) for them to exit
+func (container *SOCKContainer) terminate(deadline time.Time) {
+	pids, err := container.cg.GetPIDs()
+	if err != nil {
+		return
+	}
+	for _, pidStr := range pids {
+		if pid, err := strconv.Atoi(pidStr); err == nil {
+			syscall.Kill(pid, syscall.SIGTERM)
+		}
+	}
+
+	// a custom runtime is PID 1 of its namespace, so signals it has
+	// no handler for are ignored, and waiting would only use up the
+	// grace period
+	if container.customPid != 0 && !catchesSignal(container.customPid, syscall.SIGTERM) {
+		container.printf("custom runtime does not handle SIGTERM, not waiting for it to exit")
+		return
+	}
+
+	exited := waitUntil(deadline, func() bool {
+		pids, err := container.cg.GetPIDs()
+		return err != nil || len(pids) == 0
+	})
+	if !exited {
+		container.printf("processes still running after SIGTERM and %v grace period", shutdownGrace())
+	}
+}
+
 func (container *SOCKContainer) DestroyIfPaused(reason string) {
 	// we're allowed to implement this by unconditionally destroying
 	container.Destroy(reason)
@@ -297,12 +436,20 @@ func (container *SOCKContainer) decCgRefCount() {
 
 		t := common.T0("Destroy()/cleanup-cgroup")
 		if container.cg != nil {
+			container.recordIO()
 			container.cg.KillAndRelease()
 			container.printf("killed PIDs in CG\n")
 			container.pool.mem.adjustAvailableMB(container.cg.GetMemLimitMB())
 		}
 		t.T1()
 
+		if container.net != nil {
+			t = common.T0("Destroy()/release-network")
+			container.net.release()
+			container.net = nil
+			t.T1()
+		}
+
 		container.printf("unmount and remove dirs\n")
 		t = common.T0("Destroy()/detach-root")
 		if err := syscall.Unmount(container.containerRootDir, syscall.MNT_DETACH); err != nil {
@@ -316,12 +463,32 @@ func (container *SOCKContainer) decCgRefCount() {
 		}
 		t.T1()
 
+		if container.meta.WritableRoot {
+			overlayDir := filepath.Join(container.scratchDir, ROOT_OVERLAY_NAME)
+			if err := os.RemoveAll(overlayDir); err != nil {
+				container.printf("remove root overlay %s failed :: %v\n", overlayDir, err)
+			}
+		}
+
+		if container.meta.ScratchMB > 0 {
+			t = common.T0("Destroy()/release-scratch")
+			if err := ReleaseScratchQuota(container.scratchDir); err != nil {
+				container.printf("%v\n", err)
+			}
+			t.T1()
+		}
+
 		// Clean up ol.sock from scratchDir (scratchDir itself may be reused, e.g., for package caching)
 		sockPath := filepath.Join(container.scratchDir, "ol.sock")
 		if err := os.Remove(sockPath); err != nil && !os.IsNotExist(err) {
 			container.printf("remove socket %s failed :: %v\n", sockPath, err)
 		}
 
+		secretsPath := filepath.Join(container.scratchDir, SECRETS_ENV_NAME)
+		if err := os.Remove(secretsPath); err != nil && !os.IsNotExist(err) {
+			container.printf("remove secrets %s failed :: %v\n", secretsPath, err)
+		}
+
 		if container.parent != nil {
 			container.parent.childExit(container)
 		}
@@ -426,7 +593,7 @@ func (container *SOCKContainer) Client() *http.Client {
 
 // GetRuntimeLog returns the log of the runtime
 func (container *SOCKContainer) GetRuntimeLog() string {
-	data, err := ioutil.ReadFile(filepath.Join(container.scratchDir, "ol-runtime.log"))
+	data, err := ioutil.ReadFile(filepath.Join(container.scratchDir, RUNTIME_LOG_NAME))
 
 	if err == nil {
 		return string(data)
@@ -446,10 +613,61 @@ func (container *SOCKContainer) GetProxyLog() string {
 	return ""
 }
 
+func (container *SOCKContainer) OOMKills() (int64, error) {
+	events, err := container.cg.MemoryEvents()
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"] - container.oomKillsAtStart, nil
+}
+
+func (container *SOCKContainer) StartUsage() (func() (Usage, error), error) {
+	meter, err := container.cg.StartUsageMeter()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (Usage, error) {
+		cpuUsec, memPeakMB, err := meter.Stop()
+		return Usage{CPUUsec: cpuUsec, MemPeakMB: memPeakMB}, err
+	}, nil
+}
+
+// recordIO adds the IO of the Sandbox to the worker's stats (before
+// its cgroup is released)
+func (container *SOCKContainer) recordIO() {
+	stat, err := container.cg.IOStat()
+	if err != nil {
+		return
+	}
+	stat = stat.Sub(container.ioAtStart)
+
+	suffixes := []string{""}
+	if container.meta.Lambda != "" {
+		suffixes = append(suffixes, "/"+container.meta.Lambda)
+	}
+	for _, suffix := range suffixes {
+		common.Sum("io-read-bytes"+suffix, stat.ReadBytes)
+		common.Sum("io-write-bytes"+suffix, stat.WriteBytes)
+		common.Sum("io-read-ops"+suffix, stat.ReadOps)
+		common.Sum("io-write-ops"+suffix, stat.WriteOps)
+	}
+}
+
 func (container *SOCKContainer) DebugString() string {
 	var s = fmt.Sprintf("SOCK %s\n", container.ID())
 	s += fmt.Sprintf("ROOT DIR: %s\n", container.containerRootDir)
 	s += fmt.Sprintf("HOST DIR: %s\n", container.scratchDir)
+	s += fmt.Sprintf("META: %s\n", container.meta)
+	s += scratchDebugString(container.scratchDir, container.meta)
+	if container.net != nil {
+		s += fmt.Sprintf("NETWORK: %s\n", container.net)
+	}
 	s += container.cg.DebugString()
+	if stat, err := container.cg.IOStat(); err == nil {
+		s += fmt.Sprintf("IO: %s\n", stat.Sub(container.ioAtStart))
+	} else {
+		s += fmt.Sprintf("IO: unknown (%s)\n", err)
+	}
 	return s
 }
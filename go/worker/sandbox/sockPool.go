@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -27,7 +29,11 @@ type SOCKPool struct {
 	name          string
 	rootDirs      *common.DirMaker
 	cgPool        *cgroups.CgroupPool
+	sharedCPUs    string // with cpu.pinned_cpus, the other CPUs
+	ioDevice      string // disk of Worker_dir, for io.max ("" if unknown)
 	mem           *MemPool
+	net           *netPool
+	seccomp       *SeccompProfile // for sandboxes that don't specify one
 	eventHandlers []SandboxEventFunc
 	debugger
 }
@@ -35,20 +41,72 @@ type SOCKPool struct {
 // NewSOCKPool creates a SOCKPool.
 func NewSOCKPool(name string, mem *MemPool) (cf *SOCKPool, err error) {
 	olPath := filepath.Dir(common.Conf.Worker_dir)
-	cgPool, err := cgroups.NewCgroupPool(name, common.CgroupPoolPath(olPath))
+	poolPath := common.CgroupPoolPath(olPath)
+	if common.Conf.Rootless.Enabled {
+		// `ol worker init` (with sudo) only creates the pool root of
+		// regular workers
+		if err := cgroups.InitDelegatedPoolRoot(common.Conf.Rootless.Cgroup_root, poolPath); err != nil {
+			return nil, err
+		}
+	}
+	cgPool, err := cgroups.NewCgroupPool(name, poolPath)
 	if err != nil {
 		return nil, err
 	}
 
+	sharedCPUs := ""
+	if pinned := common.Conf.CPU.Pinned_cpus; pinned != "" {
+		if sharedCPUs, err = splitCPUs(cgPool, pinned); err != nil {
+			return nil, err
+		}
+		cgPool.SetCPUs(sharedCPUs)
+	}
+
+	// sandboxes without IO limits still get an io.max (of "max"), in
+	// case their cgroup is recycled from one with limits
+	ioDevice, err := cgroups.BlockDevice(common.Conf.Worker_dir)
+	if err == nil {
+		// the io controller is optional for rootless workers
+		ctrls, _ := os.ReadFile(filepath.Join(poolPath, "cgroup.subtree_control"))
+		if !slices.Contains(strings.Fields(string(ctrls)), "io") {
+			err = fmt.Errorf("the io controller is not enabled at %s", poolPath)
+		}
+	}
+	if err != nil {
+		if common.Conf.Limits.HasIOLimits() {
+			return nil, fmt.Errorf("cannot apply limits.io_ limits: %w", err)
+		}
+		slog.Info(fmt.Sprintf("IO limits unavailable: %v", err))
+		ioDevice = ""
+	}
+
 	rootDirs, err := common.NewDirMaker("root-"+name, common.Conf.Storage.Root.Mode())
 	if err != nil {
 		return nil, err
 	}
 
+	netPool, err := newNetPool(poolPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prepareVolumes(); err != nil {
+		return nil, err
+	}
+
+	seccomp, err := LoadSeccompProfile("", false)
+	if err != nil {
+		return nil, err
+	}
+
 	pool := &SOCKPool{
 		name:          name,
 		mem:           mem,
+		net:           netPool,
+		seccomp:       seccomp,
 		cgPool:        cgPool,
+		sharedCPUs:    sharedCPUs,
+		ioDevice:      ioDevice,
 		rootDirs:      rootDirs,
 		eventHandlers: []SandboxEventFunc{},
 	}
@@ -58,6 +116,71 @@ func NewSOCKPool(name string, mem *MemPool) (cf *SOCKPool, err error) {
 	return pool, nil
 }
 
+// splitCPUs enables cpusets in the cgroup pool, and returns the CPUs
+// other than the pinned ones
+func splitCPUs(cgPool *cgroups.CgroupPool, pinned string) (string, error) {
+	if err := cgPool.EnableCpuset(); err != nil {
+		return "", err
+	}
+	available, err := cgPool.EffectiveCPUs()
+	if err != nil {
+		return "", err
+	}
+	pinnedCPUs, err := common.ParseCPUList(pinned)
+	if err != nil {
+		return "", err
+	}
+
+	shared := []int{}
+	for _, cpu := range available {
+		if !slices.Contains(pinnedCPUs, cpu) {
+			shared = append(shared, cpu)
+		}
+	}
+	for _, cpu := range pinnedCPUs {
+		if !slices.Contains(available, cpu) {
+			return "", fmt.Errorf("cpu.pinned_cpus has CPU %d, which the worker can't use (it has %s)",
+				cpu, common.FormatCPUList(available))
+		}
+	}
+	if len(shared) == 0 {
+		return "", fmt.Errorf("cpu.pinned_cpus leaves no CPUs for other sandboxes")
+	}
+	return common.FormatCPUList(shared), nil
+}
+
+// cgPoolFor returns the pool for the cgroup of a new Sandbox, and the
+// cpu.weight of that cgroup.  With cpu.group_by_lambda, the weight is on
+// the lambda's group instead, so it is shared by the lambda's Sandboxes.
+func (pool *SOCKPool) cgPoolFor(meta *SandboxMeta) (*cgroups.CgroupPool, int, error) {
+	if !common.Conf.CPU.Group_by_lambda || meta.Lambda == "" {
+		return pool.cgPool, meta.CPUWeight, nil
+	}
+
+	cpus := pool.sharedCPUs
+	if meta.CPUPinned {
+		cpus = common.Conf.CPU.Pinned_cpus
+	}
+	group, err := pool.cgPool.Group("lambda-"+meta.Lambda, meta.CPUWeight, cpus)
+	if err != nil {
+		return nil, 0, err
+	}
+	return group, 0, nil
+}
+
+// setIOMax applies the IO limits of meta to cg, clearing any left by
+// an earlier Sandbox
+func (pool *SOCKPool) setIOMax(cg cgroups.Cgroup, meta *SandboxMeta) error {
+	if pool.ioDevice == "" {
+		if meta.hasIOLimits() {
+			return fmt.Errorf("IO limits need Worker_dir on a block device")
+		}
+		return nil
+	}
+
+	return cg.SetIOMax(pool.ioDevice, meta.ioMax())
+}
+
 func sbStr(sb Sandbox) string {
 	if sb == nil {
 		return "<nil>"
@@ -75,6 +198,39 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 
 	t := common.T0("Create()")
 	defer t.T1()
+	start := time.Now()
+
+	// the worker has no way to install a filter in a process it
+	// didn't write, so refuse rather than run it unfiltered
+	if meta.Runtime == common.RT_CUSTOM && common.Conf.Features.Enable_seccomp {
+		return nil, fmt.Errorf("custom runtimes cannot run with features.enable_seccomp, which they would bypass")
+	}
+
+	// a profile the lambda asked for is applied by the Python
+	// runtime, and only with seccomp enabled; refuse rather than
+	// silently run without it
+	if meta.Seccomp != nil {
+		if !common.Conf.Features.Enable_seccomp {
+			return nil, fmt.Errorf("seccomp profile %s needs features.enable_seccomp", meta.Seccomp)
+		}
+		if meta.Runtime != common.RT_PYTHON {
+			return nil, fmt.Errorf("seccomp profiles are only supported by the python runtime")
+		}
+	}
+
+	// decide whether we can fork before acquiring anything
+	if parent != nil && !meta.CanForkFromZygote() {
+		return nil, fmt.Errorf("sandboxes with their own network or seccomp profile cannot be forked")
+	}
+
+	if parent != nil && parent.Meta().Image != meta.Image {
+		return nil, fmt.Errorf("cannot fork a sandbox with image '%s' from one with image '%s'", meta.Image, parent.Meta().Image)
+	}
+
+	cgPool, cpuWeight, err := pool.cgPoolFor(meta)
+	if err != nil {
+		return nil, err
+	}
 
 	var cSock = &SOCKContainer{
 		pool:             pool,
@@ -91,7 +247,7 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 
 	// block until we have enough to cover the cgroup mem limits
 	t2 := t.T0("acquire-mem")
-	pool.mem.adjustAvailableMB(-meta.MemLimitMB)
+	pool.mem.acquireMB(meta.MemLimitMB, meta)
 	t2.T1()
 
 	t2 = t.T0("acquire-cgroup")
@@ -101,7 +257,13 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 	// don't want to use this cgroup feature, because the child
 	// would take the blame for ALL of the parent's allocations
 	moveMemCharge := (parent == nil)
-	cSock.cg = pool.cgPool.GetCg(meta.MemLimitMB, moveMemCharge, meta.CPUPercent)
+	cSock.cg = cgPool.GetCg(meta.MemLimitMB, moveMemCharge, meta.CPUPercent, cpuWeight)
+	if events, err := cSock.cg.MemoryEvents(); err == nil {
+		cSock.oomKillsAtStart = events["oom_kill"]
+	}
+	if stat, err := cSock.cg.IOStat(); err == nil {
+		cSock.ioAtStart = stat
+	}
 	t2.T1()
 	cSock.printf("use cgroup %s", cSock.cg.Name())
 
@@ -111,6 +273,10 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 		}
 	}()
 
+	if err := pool.setIOMax(cSock.cg, meta); err != nil {
+		return nil, err
+	}
+
 	// root file system
 	if isLeaf && cSock.codeDir == "" {
 		return nil, fmt.Errorf("leaf sandboxes must have codeDir set")
@@ -122,6 +288,17 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 	}
 	t2.T1()
 
+	if meta.Network.Isolated() {
+		if common.Conf.Rootless.Enabled {
+			return nil, fmt.Errorf("network mode '%s' is not supported by rootless workers", meta.Network.Mode)
+		}
+		t2 = t.T0("make-network")
+		if cSock.net, err = pool.net.create(id, meta.Network); err != nil {
+			return nil, fmt.Errorf("failed to create network namespace: %v", err)
+		}
+		t2.T1()
+	}
+
 	if meta.Runtime == common.RT_PYTHON {
 		// add installed packages to the path, and import the modules we'll need
 		var pyCode []string
@@ -153,7 +330,7 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 		if err := ioutil.WriteFile(path, code, 0600); err != nil {
 			return nil, err
 		}
-	} else if meta.Runtime == common.RT_NATIVE {
+	} else if meta.Runtime == common.RT_NATIVE || meta.Runtime == common.RT_CUSTOM {
 		// nothing to do?
 	} else {
 		return nil, fmt.Errorf("Unsupported runtime")
@@ -196,6 +373,7 @@ func (pool *SOCKPool) Create(parent Sandbox, isLeaf bool, codeDir, scratchDir st
 	}
 
 	// event handling
+	safe.createLatency = time.Since(start)
 	safe.startNotifyingListeners(pool.eventHandlers)
 	return c, nil
 }
@@ -219,10 +397,11 @@ func (pool *SOCKPool) Cleanup() {
 	// user is required to kill all containers before they call
 	// this.  If they did, the memory pool should be full.
 	pool.printf("make sure all memory is free")
-	pool.mem.adjustAvailableMB(-pool.mem.totalMB)
+	pool.mem.adjustAvailableMB(-pool.mem.capacityMB)
 	pool.printf("memory pool emptied")
 
 	pool.cgPool.Destroy()
+	pool.net.cleanup()
 	if err := pool.rootDirs.Cleanup(); err != nil {
 		panic(err)
 	}
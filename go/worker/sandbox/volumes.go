@@ -0,0 +1,158 @@
+package sandbox
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/open-lambda/open-lambda/go/common"
+)
+
+// VolumeBind is one of the worker's volumes, as mounted in a sandbox
+type VolumeBind struct {
+	Name     string
+	HostPath string
+	Target   string // path inside the sandbox
+	ReadOnly bool
+}
+
+func (v VolumeBind) String() string {
+	if v.ReadOnly {
+		return fmt.Sprintf("%s:%s:ro", v.Name, v.Target)
+	}
+	return fmt.Sprintf("%s:%s:rw", v.Name, v.Target)
+}
+
+// ResolveVolumes looks up the volumes a lambda's ol.yaml asks for, checking
+// that the worker config lets this lambda mount them that way
+func ResolveVolumes(lambdaName string, mounts []common.VolumeMount) ([]VolumeBind, error) {
+	var binds []VolumeBind
+	for _, mount := range mounts {
+		vol, ok := common.Conf.Volumes[mount.Name]
+		if !ok {
+			return nil, fmt.Errorf("volume '%s' is not configured on this worker", mount.Name)
+		}
+		if !vol.Allows(lambdaName, mount.ReadOnly()) {
+			if mount.ReadOnly() {
+				return nil, fmt.Errorf("lambda '%s' may not mount volume '%s'", lambdaName, mount.Name)
+			}
+			return nil, fmt.Errorf("lambda '%s' may not mount volume '%s' read-write", lambdaName, mount.Name)
+		}
+		binds = append(binds, VolumeBind{
+			Name:     mount.Name,
+			HostPath: vol.Path,
+			Target:   mount.Mount,
+			ReadOnly: mount.ReadOnly(),
+		})
+	}
+	return binds, nil
+}
+
+// prepareVolumes creates the directories of the worker's volumes, and
+// mounts the backing filesystems of those with a size limit.  Volumes
+// stay mounted when the worker stops (they hold durable state), so this
+// skips anything that is already mounted.
+func prepareVolumes() error {
+	for name, vol := range common.Conf.Volumes {
+		if err := os.MkdirAll(vol.Path, 0755); err != nil {
+			return fmt.Errorf("could not create dir of volume '%s': %v", name, err)
+		}
+
+		if vol.Size_mb == 0 {
+			continue
+		}
+
+		mounted, err := isMountPoint(vol.Path)
+		if err != nil {
+			return err
+		} else if mounted {
+			continue
+		}
+
+		img := vol.Path + ".img"
+		if err := createVolumeImage(img, vol.Size_mb); err != nil {
+			return fmt.Errorf("could not create image of volume '%s': %v", name, err)
+		}
+
+		slog.Info(fmt.Sprintf("mount volume '%s' (%d MB) at %s", name, vol.Size_mb, vol.Path))
+		if out, err := exec.Command("mount", "-o", "loop", img, vol.Path).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not mount %s at %s: %v: %s", img, vol.Path, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// createVolumeImage makes a (sparse) ext4 image of sizeMB, unless there
+// is one already.  Existing images are never resized.
+func createVolumeImage(img string, sizeMB int) error {
+	if info, err := os.Stat(img); err == nil {
+		if info.Size() != int64(sizeMB)*1024*1024 {
+			slog.Warn(fmt.Sprintf("%s is %d bytes, not %d MB (existing images are not resized)", img, info.Size(), sizeMB))
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(img, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(int64(sizeMB) * 1024 * 1024)
+	f.Close()
+	if err == nil {
+		var out []byte
+		if out, err = exec.Command("mkfs.ext4", "-q", "-F", img).CombinedOutput(); err != nil {
+			err = fmt.Errorf("mkfs.ext4 failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	if err != nil {
+		os.Remove(img)
+	}
+	return err
+}
+
+// isMountPoint reports whether path is on a different device than its
+// parent (good enough for the loop mounts made here)
+func isMountPoint(path string) (bool, error) {
+	var st, parentSt syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false, err
+	}
+	if err := syscall.Stat(filepath.Dir(path), &parentSt); err != nil {
+		return false, err
+	}
+	return st.Dev != parentSt.Dev, nil
+}
+
+// mountVolumes binds a sandbox's volumes into its root.  The mount points
+// are created on a small tmpfs over /mnt, as the base image is read-only.
+func mountVolumes(rootDir string, volumes []VolumeBind) error {
+	sbMntDir := filepath.Join(rootDir, "mnt")
+	if err := syscall.Mount("tmpfs", sbMntDir, "tmpfs", 0, "size=64k,mode=755"); err != nil {
+		return fmt.Errorf("failed to mount tmpfs at %s (does the base image have /mnt?): %v", sbMntDir, err)
+	}
+
+	for _, vol := range volumes {
+		target := filepath.Join(rootDir, vol.Target)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+
+		if err := syscall.Mount(vol.HostPath, target, "", common.BIND, ""); err != nil {
+			return fmt.Errorf("failed to bind volume '%s': %s -> %s :: %v", vol.Name, vol.HostPath, target, err)
+		}
+
+		if vol.ReadOnly {
+			if err := syscall.Mount("none", target, "", common.BIND_RO, ""); err != nil {
+				return fmt.Errorf("failed to bind volume '%s' RO: %v", vol.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -19,10 +19,54 @@ static PyObject *ol_fork(PyObject *module) {
   return Py_BuildValue("i", res);
 }
 
-static PyObject *ol_enable_seccomp(PyObject *module) {
-  scmp_filter_ctx ctx = seccomp_init(SCMP_ACT_ERRNO(1));
+// enable_seccomp([syscalls], [audit])
+//
+// syscalls: list of names to allow (None or omitted for the built-in list)
+// audit: if true, log other syscalls (in the kernel log) instead of denying them
+static PyObject *ol_enable_seccomp(PyObject *module, PyObject *args) {
+  PyObject *syscalls = Py_None;
+  int audit = 0;
+  if (!PyArg_ParseTuple(args, "|Op", &syscalls, &audit)) {
+    return NULL;
+  }
+
+  scmp_filter_ctx ctx = seccomp_init(audit ? SCMP_ACT_LOG : SCMP_ACT_ERRNO(1));
   int rc = 0;
 
+  if (syscalls != Py_None) {
+    PyObject *seq = PySequence_Fast(syscalls, "syscalls must be a list");
+    if (seq == NULL) {
+      seccomp_release(ctx);
+      return NULL;
+    }
+
+    for (Py_ssize_t i=0; i<PySequence_Fast_GET_SIZE(seq); i++) {
+      const char *name = PyUnicode_AsUTF8(PySequence_Fast_GET_ITEM(seq, i));
+      if (name == NULL) {
+        Py_DECREF(seq);
+        seccomp_release(ctx);
+        return NULL;
+      }
+
+      int nr = seccomp_syscall_resolve_name(name);
+      if (nr == __NR_SCMP_ERROR) {
+        // e.g., a syscall that doesn't exist on this architecture
+        fprintf(stderr, "seccomp: skipping unknown syscall %s\n", name);
+        continue;
+      }
+
+      rc = seccomp_rule_add(ctx, SCMP_ACT_ALLOW, nr, 0);
+      if (rc < 0) {
+        Py_DECREF(seq);
+        goto out;
+      }
+    }
+    Py_DECREF(seq);
+
+    rc = seccomp_load(ctx);
+    goto out;
+  }
+
   // allow similar calls as the Docker default:
   // https://github.com/moby/moby/blob/master/profiles/seccomp/default.json
   // - close_range, epoll_pwait2, faccessat2, openat2
@@ -381,13 +425,14 @@ static PyObject *ol_enable_seccomp(PyObject *module) {
   rc = seccomp_load(ctx);
 
  out:
+  seccomp_release(ctx);
   return Py_BuildValue("i", rc);
 }
 
 static PyMethodDef OlMethods[] = {
                                   {"unshare", (PyCFunction)ol_unshare, METH_NOARGS, "unshare"},
                                   {"fork", (PyCFunction)ol_fork, METH_NOARGS, "fork"},
-                                  {"enable_seccomp", (PyCFunction)ol_enable_seccomp, METH_NOARGS, "enable_seccomp"},
+                                  {"enable_seccomp", (PyCFunction)ol_enable_seccomp, METH_VARARGS, "enable_seccomp"},
                                   {NULL, NULL, 0, NULL}
 };
 
@@ -4,6 +4,7 @@
 
 import os
 import sys
+import json
 import socket
 import struct
 import traceback
@@ -12,7 +13,7 @@ sys.path.append("/usr/local/lib/python3.10/dist-packages")
 sys.path.append(os.path.dirname(os.path.abspath(__file__)))
 
 import ol
-from server_common import web_server_on_sock
+from server_common import web_server_on_sock, LISTEN_BACKLOG
 
 file_sock_path = "/host/ol.sock"
 file_sock = None
@@ -86,13 +87,23 @@ def start_container():
     return_val = ol.unshare()
     assert return_val == 0
 
+    # send output to this container's own scratch dir, if the worker
+    # keeps runtime logs (a forked child would otherwise keep writing to
+    # its zygote's log)
+    runtime_log_path = os.environ.get('OL_RUNTIME_LOG')
+    if runtime_log_path:
+        log_fd = os.open(runtime_log_path, os.O_WRONLY | os.O_CREAT | os.O_APPEND, 0o644)
+        os.dup2(log_fd, 1)
+        os.dup2(log_fd, 2)
+        os.close(log_fd)
+
     # we open a new .sock file in the child, before starting the grand
     # child, which will actually use it.  This is so that the parent
     # can know that once the child exits, it is safe to start sending
     # messages to the sock file.
     file_sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
     file_sock.bind(file_sock_path)
-    file_sock.listen(1)  # backlog=1: we handle one request at a time, no concurrency
+    file_sock.listen(LISTEN_BACKLOG)
 
     pid = os.fork()
     assert pid >= 0
@@ -126,16 +137,25 @@ def main():
     if len(sys.argv) < 2:
         print("Expected execution: chroot <path_to_root_fs> python3 server.py <path_to_bootstrap.py> [cgroup-count] [enable-seccomp]")
         print("    cgroup-count: number of FDs (starting at 3) that refer to /sys/fs/cgroup/..../cgroup.procs files")
-        print("    enable-seccomp: true/false to enable or disables seccomp filtering")
+        print("    enable-seccomp: true/false to enable or disables seccomp filtering, or the path of a seccomp profile")
         sys.exit(1)
 
     print('server.py: started new process with args: ' + " ".join(sys.argv))
 
-    #enable_seccomp if enable-seccomp is not passed
-    if len(sys.argv) < 3 or sys.argv[3] == 'true':
+    # enable seccomp with the built-in allowlist if enable-seccomp is
+    # not passed.  Otherwise, it may be a path to a profile written by
+    # the worker: {"name": ..., "syscalls": [...] or null, "audit": bool}
+    seccomp = sys.argv[3] if len(sys.argv) > 3 else 'true'
+    if seccomp == 'true':
         return_code = ol.enable_seccomp()
         assert return_code >= 0
         print('seccomp enabled')
+    elif seccomp != 'false':
+        with open(seccomp, encoding='utf-8') as f:
+            profile = json.load(f)
+        return_code = ol.enable_seccomp(profile["syscalls"], profile["audit"])
+        assert return_code >= 0
+        print(f'seccomp enabled with profile {profile["name"]}' + (' (audit)' if profile["audit"] else ''))
 
     bootstrap_path = sys.argv[1]
     cgroup_fds = 0
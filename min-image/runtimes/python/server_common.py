@@ -10,12 +10,21 @@ import json
 import asyncio
 import http.client
 import importlib
+import threading
 import traceback
 from enum import Enum
 from urllib.parse import urlparse
 
 from dotenv import load_dotenv
 
+# the worker POSTs here before destroying the sandbox (scale-down, code
+# updates), so the lambda can flush buffers and close connections
+SHUTDOWN_PATH = "/_ol/shutdown"
+
+# pending connections the lambda socket holds; with concurrency > 1,
+# the worker may connect several times before we accept
+LISTEN_BACKLOG = 128
+
 
 class EntryType(Enum):
     FUNC = "func"    # f(event) -> result
@@ -100,7 +109,7 @@ def handle_wsgi(conn, request, entry_point, app_name, path_info, query_string):
         "wsgi.url_scheme": "http",
         "wsgi.input": request,  # request.read() handles Content-Length limiting
         "wsgi.errors": sys.stderr,
-        "wsgi.multithread": False,
+        "wsgi.multithread": concurrency() > 1,
         "wsgi.multiprocess": False,
         "wsgi.run_once": False,
     }
@@ -178,6 +187,62 @@ def handle_asgi(conn, request, entry_point, app_name, path_info, query_string):
             conn.sendall(error)
 
 
+def concurrency():
+    """How many requests the worker may send at once (ol.yaml concurrency)"""
+    return int(os.environ.get('OL_CONCURRENCY', '1'))
+
+
+def handle_conn(conn, request, entry_point, entry_type):
+    """Serve one request, and close its connection"""
+    try:
+        # Parse path: `/run/<app-name>/a/b/c` -> app_name, `/a/b/c`, query
+        parsed = urlparse(request.path)
+        parts = parsed.path.split("/")  # ["", "run", <app-name>, ...]
+        app_name = parts[2]
+        path_info = '/' + '/'.join(parts[3:])
+        query_string = parsed.query
+
+        if entry_type == EntryType.FUNC:
+            handle_func(conn, request, entry_point)
+        elif entry_type == EntryType.WSGI:
+            handle_wsgi(conn, request, entry_point, app_name, path_info, query_string)
+        elif entry_type == EntryType.ASGI:
+            handle_asgi(conn, request, entry_point, app_name, path_info, query_string)
+    finally:
+        conn.close()
+
+
+def handle_conn_in_thread(conn, request, entry_point, entry_type):
+    """handle_conn, for a thread of its own (nothing else would report an error)"""
+    try:
+        handle_conn(conn, request, entry_point, entry_type)
+    except Exception:
+        traceback.print_exc()
+
+
+def handle_shutdown(conn, handler_module):
+    """Run the module's on_shutdown() hook, if any, before the server exits"""
+    status, status_text = 200, "OK"
+    hook = getattr(handler_module, 'on_shutdown', None)
+    try:
+        if hook is not None:
+            result = hook()
+            if asyncio.iscoroutine(result):
+                asyncio.run(result)
+    except Exception:
+        traceback.print_exc()
+        status, status_text = 500, "Internal Server Error"
+
+    # forked servers exit with os._exit, which doesn't flush
+    sys.stdout.flush()
+    sys.stderr.flush()
+
+    conn.sendall(f"HTTP/1.1 {status} {status_text}\r\n".encode())
+    conn.sendall(b"Content-Length: 0\r\n")
+    conn.sendall(b"Connection: close\r\n")
+    conn.sendall(b"\r\n")
+
+
 def web_server_on_sock(file_sock, server_name="server"):
     """
     Main web server loop. Accepts connections and dispatches to appropriate handler.
@@ -187,14 +252,23 @@ def web_server_on_sock(file_sock, server_name="server"):
         server_name: Name for logging (e.g., "server.py" or "server_legacy.py")
     """
     print(f"{server_name}: start web server on fd: {file_sock.fileno()}")
-    sys.path.append('/handler')
+    handler_dir = os.environ.get('OL_HANDLER_DIR', '/handler')
+    host_dir = os.environ.get('OL_HOST_DIR', '/host')
+    sys.path.append(handler_dir)
 
     # Load environment variables from .env file if it exists
-    env_path = '/handler/.env'
+    env_path = os.path.join(handler_dir, '.env')
     if os.path.exists(env_path):
         load_dotenv(env_path)
         print(f"{server_name}: loaded environment variables from {env_path}")
 
+    # Secrets are resolved by the worker into this sandbox's scratch dir
+    secrets_path = os.path.join(host_dir, 'ol-secrets.json')
+    if os.path.exists(secrets_path):
+        with open(secrets_path) as f:
+            os.environ.update(json.load(f))
+        print(f"{server_name}: loaded secrets from {secrets_path}")
+
     # Import handler module
     entry_file = os.environ.get('OL_ENTRY_FILE', 'f.py')
     if not entry_file.endswith('.py'):
@@ -230,18 +304,13 @@ def web_server_on_sock(file_sock, server_name="server"):
         conn, _ = file_sock.accept()
         request = RequestParser(conn)
 
-        # Parse path: `/run/<app-name>/a/b/c` -> app_name, `/a/b/c`, query
-        parsed = urlparse(request.path)
-        parts = parsed.path.split("/")  # ["", "run", <app-name>, ...]
-        app_name = parts[2]
-        path_info = '/' + '/'.join(parts[3:])
-        query_string = parsed.query
-
-        if entry_type == EntryType.FUNC:
-            handle_func(conn, request, entry_point)
-        elif entry_type == EntryType.WSGI:
-            handle_wsgi(conn, request, entry_point, app_name, path_info, query_string)
-        elif entry_type == EntryType.ASGI:
-            handle_asgi(conn, request, entry_point, app_name, path_info, query_string)
+        if request.command == "POST" and request.path == SHUTDOWN_PATH:
+            print(f"{server_name}: shutting down")
+            handle_shutdown(conn, handler_module)
+            conn.close()
+            return
 
-        conn.close()
+        if concurrency() > 1:
+            threading.Thread(target=handle_conn_in_thread, args=(conn, request, entry_point, entry_type), daemon=True).start()
+        else:
+            handle_conn(conn, request, entry_point, entry_type)
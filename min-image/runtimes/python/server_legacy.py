@@ -1,8 +1,12 @@
 '''
-Python Runtime for Docker
+Python Runtime for Docker and the process sandbox
 
 Note: SOCK doesn't use this anymore (it uses server.py instead), but
 this is still here because we haven't updated docker.go yet.
+
+The process sandbox runs this directly on the host, without a chroot,
+so the directories can be overridden with OL_HOST_DIR, OL_PKGS_DIR,
+and OL_HANDLER_DIR.
 '''
 
 #pylint: disable=invalid-name,line-too-long,global-statement
@@ -16,11 +20,11 @@ import socket
 sys.path.append(os.path.dirname(os.path.abspath(__file__)))
 
 from dotenv import load_dotenv
-from server_common import web_server_on_sock
+from server_common import web_server_on_sock, LISTEN_BACKLOG
 
-HOST_DIR = '/host'
-PKGS_DIR = '/packages'
-HANDLER_DIR = '/handler'
+HOST_DIR = os.environ.get('OL_HOST_DIR', '/host')
+PKGS_DIR = os.environ.get('OL_PKGS_DIR', '/packages')
+HANDLER_DIR = os.environ.get('OL_HANDLER_DIR', '/handler')
 
 # Load environment variables from .env file if it exists
 env_path = f'{HANDLER_DIR}/.env'
@@ -50,7 +54,7 @@ def lambda_server():
         os.remove(SOCK_PATH)
     file_sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
     file_sock.bind(SOCK_PATH)
-    file_sock.listen(1)
+    file_sock.listen(LISTEN_BACKLOG)
 
     # Notify worker server that we are ready
     with open(SERVER_PIPE_PATH, 'w', encoding='utf-8') as pipe: